@@ -0,0 +1,78 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	AdminTokenHeader = "X-Admin-Token"
+)
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func (p *PostAPI) registerAdminRoutes(e *echo.Echo) {
+	if p.Options.AdminPath == "" {
+		return
+	}
+
+	admin := e.Group(p.Options.AdminPath, p.adminAuth)
+
+	admin.Get("/splits", p.adminListSplitsHandle)
+	admin.Put("/splits/:api/:version/weights", p.adminSetSplitWeightsHandle)
+	admin.Delete("/cache/:api/:version", p.adminInvalidateCacheHandle)
+	admin.Get("/faults", p.adminListFaultsHandle)
+	admin.Post("/faults", p.adminAddFaultHandle)
+	admin.Delete("/faults/:id", p.adminRemoveFaultHandle)
+	admin.Get("/maintenance", p.adminListMaintenanceHandle)
+	admin.Put("/maintenance", p.adminEnableMaintenanceHandle)
+	admin.Delete("/maintenance", p.adminDisableMaintenanceHandle)
+}
+
+// adminAuth checks the admin token, all requests are refused when
+// Options.AdminToken is empty
+func (p *PostAPI) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if p.Options.AdminToken == "" {
+			return c.JSON(http.StatusForbidden, adminError{Error: "admin token is not configured"})
+		}
+
+		token := c.Request().Header().Get(AdminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(p.Options.AdminToken)) != 1 {
+			return c.JSON(http.StatusUnauthorized, adminError{Error: "invalid admin token"})
+		}
+
+		return next(c)
+	}
+}
+
+func (p *PostAPI) adminListSplitsHandle(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, p.Splits())
+}
+
+// adminSetSplitWeightsHandle changes the weights of a split, the body is a
+// json object of target name to weight. Use * as version for the split of
+// all versions.
+func (p *PostAPI) adminSetSplitWeightsHandle(c echo.Context) (err error) {
+	var weights map[string]int
+	if err = c.Bind(&weights); err != nil {
+		return c.JSON(http.StatusBadRequest, adminError{Error: err.Error()})
+	}
+
+	version := c.Param("version")
+	if version == "*" {
+		version = ""
+	}
+
+	if err = p.SetSplitWeights(c.Param("api"), version, weights); err != nil {
+		return c.JSON(http.StatusBadRequest, adminError{Error: err.Error()})
+	}
+
+	split, _ := p.getSplit(c.Param("api"), version)
+
+	return c.JSON(http.StatusOK, split)
+}
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"expvar"
 	"github.com/micro/go-micro/selector"
+	"net"
+	"net/http"
+	"regexp"
 	"sync"
 	"time"
 
+	"github.com/gogap-micro/post-api/api/helper"
 	"github.com/micro/go-micro/broker"
 	"github.com/micro/go-micro/client"
 	"github.com/micro/go-micro/registry"
@@ -18,8 +23,9 @@ import (
 )
 
 type microService struct {
-	Service string
-	Method  string
+	Service  string
+	Method   string
+	Metadata map[string]string
 }
 
 type PostAPI struct {
@@ -27,12 +33,57 @@ type PostAPI struct {
 
 	httpSrv    *echo.Echo
 	stopedChan chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
 
-	apiService map[string]map[string]microService
+	metrics *expvar.Map
 
-	reglocker sync.Mutex
+	apiService    map[string]map[string]microService
+	staticService map[string]map[string]microService
+	serviceNodes  map[string]map[string]*registry.Node
+	splits        map[string]*TrafficSplit
+	splitWeights  map[string]map[string]int
+
+	nodeLabelTable   map[string]*NodeLabels
+	nodeLabelCallers []*net.IPNet
+
+	hashKeys  map[string]*HashKey
+	hashRings map[string]*hashRing
+
+	fixtures map[string][]*Fixture
+
+	mirrors     map[string]*Mirror
+	mirrorSlots chan struct{}
+
+	faults      []*FaultRule
+	faultLocker sync.Mutex
+
+	maintenance       map[string]*MaintenanceSwitch
+	maintenanceLocker sync.Mutex
+
+	hedgeBudget   hedgeBudget
+	latencies     map[string]*latencyWindow
+	latencyLocker sync.Mutex
+
+	coalesceGroup    coalesceGroup
+	idempotencyGroup coalesceGroup
+
+	schemas schemaCache
+
+	deprecatedClients topCounter
+
+	recorder *recorder
+
+	snapshotChan chan struct{}
+	stale        int32
+	ready        int32
+
+	reglocker sync.RWMutex
 
 	timerPool sync.Pool
+
+	initOnce sync.Once
+	initErr  error
 }
 
 func NewPostAPI(opts ...Option) (srv *PostAPI, err error) {
@@ -50,10 +101,25 @@ func NewPostAPI(opts ...Option) (srv *PostAPI, err error) {
 
 			RequestTopic:  DefaultRequestTopic,
 			ResponseTopic: DefaultResponseTopic,
+			MirrorTopic:   DefaultMirrorTopic,
+
+			ClientIDHeader: DefaultClientIDHeader,
 		},
-		httpSrv:    nil,
-		apiService: make(map[string]map[string]microService),
-		stopedChan: make(chan struct{}),
+		httpSrv:          nil,
+		apiService:       make(map[string]map[string]microService),
+		serviceNodes:     make(map[string]map[string]*registry.Node),
+		splitWeights:     make(map[string]map[string]int),
+		hashRings:        make(map[string]*hashRing),
+		latencies:        make(map[string]*latencyWindow),
+		coalesceGroup:    coalesceGroup{calls: make(map[string]*coalescedCall)},
+		idempotencyGroup: coalesceGroup{calls: make(map[string]*coalescedCall)},
+		schemas:          schemaCache{schemas: make(map[string]*helper.JSONSchema), regexps: make(map[string]*regexp.Regexp)},
+		mirrorSlots:      make(chan struct{}, DefaultMirrorConcurrency),
+		maintenance:      make(map[string]*MaintenanceSwitch),
+		snapshotChan:     make(chan struct{}, 1),
+		stopedChan:       make(chan struct{}),
+		stopChan:         make(chan struct{}),
+		metrics:          new(expvar.Map).Init(),
 
 		timerPool: sync.Pool{New: func() interface{} { t := time.NewTimer(time.Second * 30); t.Stop(); return t }},
 	}
@@ -62,23 +128,55 @@ func NewPostAPI(opts ...Option) (srv *PostAPI, err error) {
 		opt(&postAPI.Options)
 	}
 
+	if postAPI.Options.Cache == nil {
+		postAPI.Options.Cache = NewLRUCache(DefaultCacheSize)
+	}
+
+	if postAPI.Options.IdempotencyStore == nil {
+		postAPI.Options.IdempotencyStore = NewMemoryIdempotencyStore(DefaultIdempotencySize)
+	}
+
+	postAPI.metrics.Set("deprecated_calls", new(expvar.Map).Init())
+	postAPI.metrics.Set("deprecated_clients", expvar.Func(postAPI.deprecatedClients.counts))
+	postAPI.metrics.Set("coalesce_ratio", expvar.Func(postAPI.coalesceRatio))
+	postAPI.metrics.Set("mirror_outcomes", new(expvar.Map).Init())
+	postAPI.metrics.Set("mirror_latency_delta_ms", new(expvar.Map).Init())
+
+	if postAPI.nodeLabelCallers, err = parseCallers(postAPI.Options.NodeLabelCallers); err != nil {
+		return
+	}
+
+	if err = postAPI.loadMaintenance(); err != nil {
+		return
+	}
+
+	if postAPI.Options.Record.File != "" {
+		if postAPI.recorder, err = newRecorder(postAPI.Options.Record, postAPI.logger()); err != nil {
+			return
+		}
+	}
+
 	httpSrv := echo.New()
 
 	httpSrv.Use(middleware.BodyLimit(postAPI.Options.BodyLimit))
 
 	groupRoot := httpSrv.Group("")
 	groupRoot.Get("/ping", postAPI.pingHandle)
+	groupRoot.Get("/ready", postAPI.readyHandle)
+	groupRoot.Get("/metrics", postAPI.metricsHandle)
 	groupRoot.Get("/favicon.ico", postAPI.faviconICONHandle)
 
 	groupAPI := groupRoot.Group(
 		postAPI.Options.Path,
 	)
 
-	middlewares := append([]echo.MiddlewareFunc{postAPI.cors, postAPI.writeBasicHeaders, postAPI.parseAPIRequests, postAPI.onRequestEvent}, postAPI.Options.Middlewares...)
+	middlewares := append([]echo.MiddlewareFunc{postAPI.cors, postAPI.writeBasicHeaders, postAPI.parseAPIRequests, postAPI.onRequestEvent, postAPI.recordCalls}, postAPI.Options.Middlewares...)
 
 	groupAPI.Post("/:version", postAPI.rpcHandle, middlewares...)
 	groupAPI.Options("/:version", nil, postAPI.cors, postAPI.writeBasicHeaders)
 
+	postAPI.registerAdminRoutes(httpSrv)
+
 	httpSrv.SetHTTPErrorHandler(postAPI.errorHandle)
 	httpSrv.SetLogger(wrapperLogger(postAPI.Options.Logger))
 
@@ -89,22 +187,54 @@ func NewPostAPI(opts ...Option) (srv *PostAPI, err error) {
 	return
 }
 
+func (p *PostAPI) initMicro() error {
+	p.initOnce.Do(func() {
+		if p.initErr = p.Options.Client.Init(client.Transport(p.Options.Transport)); p.initErr != nil {
+			return
+		}
+
+		if p.initErr = p.Options.Client.Init(client.Registry(p.Options.Registry)); p.initErr != nil {
+			return
+		}
+
+		if p.initErr = p.Options.Selector.Init(selector.Registry(p.Options.Registry)); p.initErr != nil {
+			return
+		}
+
+		if p.initErr = p.Options.Client.Init(client.Selector(p.Options.Selector)); p.initErr != nil {
+			return
+		}
+
+		if p.Options.Broker != nil {
+			p.initErr = p.Options.Broker.Init(broker.Registry(p.Options.Registry))
+		}
+	})
+
+	return p.initErr
+}
+
 func (p *PostAPI) Run() (err error) {
 
-	if err = p.Options.Client.Init(client.Transport(p.Options.Transport)); err != nil {
+	if err = p.initMicro(); err != nil {
 		return
 	}
 
-	if err = p.Options.Client.Init(client.Registry(p.Options.Registry)); err != nil {
-		return
-	}
+	if p.Options.RouteFile != "" {
+		if err = p.loadRouteFile(); err != nil {
+			return
+		}
 
-	if err = p.Options.Client.Init(client.Selector(p.Options.Selector)); err != nil {
-		return
+		go p.watchRouteFile()
 	}
 
-	if err = p.Options.Broker.Init(broker.Registry(p.Options.Registry)); err != nil {
-		return
+	if p.Options.FixtureFile != "" {
+		if err = p.loadFixtures(); err != nil {
+			return
+		}
+
+		p.logger().Warnf("mock backend mode, apis in %s are answered by fixtures", p.Options.FixtureFile)
+
+		go p.watchFixtures()
 	}
 
 	conf := engine.Config{
@@ -122,7 +252,9 @@ func (p *PostAPI) Run() (err error) {
 		echoEngine = standard.WithConfig(conf)
 	}
 
-	go p.httpSrv.Run(echoEngine)
+	if p.Options.Address != "" {
+		go p.httpSrv.Run(echoEngine)
+	}
 
 	if p.Options.Broker != nil {
 		if err = p.Options.Broker.Connect(); err != nil {
@@ -130,12 +262,19 @@ func (p *PostAPI) Run() (err error) {
 		}
 	}
 
-	var regWatcher registry.Watcher
-	if regWatcher, err = p.Options.Registry.Watch(); err != nil {
+	if err = p.subscribeCacheInvalidation(); err != nil {
 		return
 	}
 
-	if err = p.watch(regWatcher); err != nil {
+	if p.Options.SnapshotFile != "" {
+		go p.snapshotLoop()
+	}
+
+	if p.recorder != nil {
+		defer p.recorder.close()
+	}
+
+	if err = p.superviseWatch(); err != nil {
 		return
 	}
 
@@ -143,3 +282,21 @@ func (p *PostAPI) Run() (err error) {
 
 	return
 }
+
+// Handler returns the http handler of the gateway, it could be served by
+// another server when Address is empty
+func (p *PostAPI) Handler() http.Handler {
+	s := standard.New("")
+	s.SetHandler(p.httpSrv)
+	s.SetLogger(p.httpSrv.Logger())
+
+	return s
+}
+
+// Stop stops watching the registry and the background loops, Run returns
+// after the registry watcher is stopped
+func (p *PostAPI) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/labstack/echo"
+	"github.com/micro/go-micro/broker"
+	"golang.org/x/net/context"
+)
+
+const (
+	APICacheHeader = "X-Api-Cache"
+
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+	CacheBypass = "bypass"
+
+	DefaultCacheSize = 10000
+)
+
+// CacheKey identifies a cached result, Values are the values of the key
+// fields declared by the api joined by commas, or the sha1 of the whole
+// content when the api declares no key fields
+type CacheKey struct {
+	API     string `json:"api"`
+	Version string `json:"version"`
+	Values  string `json:"values"`
+}
+
+func (p CacheKey) String() string {
+	return p.API + ":" + p.Version + "|" + p.Values
+}
+
+// CachedResult is the value stored in the Cache, ETag is the tag of Result
+// when it was stored so the hits carry the tag of the miss
+type CachedResult struct {
+	Result interface{} `json:"result"`
+	ETag   string      `json:"etag"`
+}
+
+// Cache stores the results of the apis marked by helper.Cacheable as
+// CachedResult, the default is an in-memory LRU of DefaultCacheSize entries
+type Cache interface {
+	Get(key CacheKey) (result interface{}, exist bool)
+	Set(key CacheKey, result interface{}, ttl time.Duration)
+	// Invalidate removes the entries of api, of all versions when version is
+	// empty and of all keys when values is empty, it returns the count of the
+	// removed entries
+	Invalidate(api, version, values string) int
+}
+
+// CacheInvalidation is the message of the cache invalidation topic
+type CacheInvalidation struct {
+	API     string `json:"api"`
+	Version string `json:"version,omitempty"`
+	Key     string `json:"key,omitempty"`
+}
+
+type lruEntry struct {
+	key       CacheKey
+	result    interface{}
+	expiresAt time.Time
+}
+
+type lruCache struct {
+	locker  sync.Mutex
+	size    int
+	list    *list.List
+	entries map[CacheKey]*list.Element
+}
+
+// NewLRUCache returns an in-memory cache keeping at most size entries
+func NewLRUCache(size int) Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	return &lruCache{
+		size:    size,
+		list:    list.New(),
+		entries: make(map[CacheKey]*list.Element),
+	}
+}
+
+func (p *lruCache) Get(key CacheKey) (result interface{}, exist bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	elem, exist := p.entries[key]
+	if !exist {
+		return
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		p.remove(elem)
+		return nil, false
+	}
+
+	p.list.MoveToFront(elem)
+
+	return entry.result, true
+}
+
+func (p *lruCache) Set(key CacheKey, result interface{}, ttl time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	entry := &lruEntry{key: key, result: result, expiresAt: time.Now().Add(ttl)}
+
+	if elem, exist := p.entries[key]; exist {
+		elem.Value = entry
+		p.list.MoveToFront(elem)
+		return
+	}
+
+	p.entries[key] = p.list.PushFront(entry)
+
+	for p.list.Len() > p.size {
+		p.remove(p.list.Back())
+	}
+}
+
+func (p *lruCache) Invalidate(api, version, values string) (removed int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for key, elem := range p.entries {
+		if key.API != api ||
+			(version != "" && key.Version != version) ||
+			(values != "" && key.Values != values) {
+			continue
+		}
+
+		p.remove(elem)
+		removed++
+	}
+
+	return
+}
+
+func (p *lruCache) remove(elem *list.Element) {
+	p.list.Remove(elem)
+	delete(p.entries, elem.Value.(*lruEntry).key)
+}
+
+type cachePolicy struct {
+	TTL  time.Duration
+	Keys []hashKeySource
+}
+
+// parseCachePolicy reads the metadata written by helper.Cacheable
+func parseCachePolicy(metadata map[string]string) (policy cachePolicy, exist bool) {
+	ttl, err := time.ParseDuration(metadata[helper.APICacheTTLMetadataKey])
+	if err != nil || ttl <= 0 {
+		return
+	}
+
+	policy.TTL = ttl
+
+	for _, key := range strings.Split(metadata[helper.APICacheKeysMetadataKey], ",") {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+
+		source, err := parseKeySource("cache key", key)
+		if err != nil {
+			return
+		}
+
+		policy.Keys = append(policy.Keys, source)
+	}
+
+	exist = true
+
+	return
+}
+
+func (p cachePolicy) key(c echo.Context, ctx context.Context, api, version string, content map[string]interface{}) (key CacheKey, err error) {
+	key = CacheKey{API: api, Version: version}
+
+	if len(p.Keys) == 0 {
+		var data []byte
+		if data, err = json.Marshal(content); err != nil {
+			return
+		}
+
+		sum := sha1.Sum(data)
+		key.Values = hex.EncodeToString(sum[:])
+
+		return
+	}
+
+	values := make([]string, 0, len(p.Keys))
+	for _, source := range p.Keys {
+		values = append(values, source.value(c, ctx, content))
+	}
+
+	key.Values = strings.Join(values, ",")
+
+	return
+}
+
+// cachedCall answers the call from the cache for the apis marked by
+// helper.Cacheable, successful results of fn are stored. Calls pinned by
+// the node labels header are never cached and Cache-Control: no-cache skips
+// the lookup.
+func (p *PostAPI) cachedCall(c echo.Context, ctx context.Context, api, version string, srv microService, content map[string]interface{}, fn func() PostAPIResponse) (resp PostAPIResponse) {
+	policy, cacheable := parseCachePolicy(srv.Metadata)
+	if !cacheable || p.Options.Cache == nil {
+		return fn()
+	}
+
+	if c.Request().Header().Get(APINodeLabelsHeader) != "" {
+		resp = fn()
+		resp.Cache = CacheBypass
+		return
+	}
+
+	key, err := policy.key(c, ctx, api, version, content)
+	if err != nil {
+		resp = fn()
+		resp.Cache = CacheBypass
+		return
+	}
+
+	status := CacheMiss
+
+	if strings.Contains(strings.ToLower(c.Request().Header().Get("Cache-Control")), "no-cache") {
+		status = CacheBypass
+	} else if value, exist := p.Options.Cache.Get(key); exist {
+		if cached, ok := value.(CachedResult); ok {
+			p.metrics.Add("cache_hits", 1)
+			return PostAPIResponse{Result: cached.Result, ETag: cached.ETag, Cache: CacheHit}
+		}
+	}
+
+	p.metrics.Add("cache_misses", 1)
+
+	resp = fn()
+	resp.Cache = status
+
+	if resp.Code == 0 {
+		resp = withETag(resp)
+		p.Options.Cache.Set(key, CachedResult{Result: resp.Result, ETag: resp.ETag}, policy.TTL)
+	}
+
+	return
+}
+
+func (p *PostAPI) invalidateCache(inv CacheInvalidation) int {
+	if p.Options.Cache == nil || inv.API == "" {
+		return 0
+	}
+
+	removed := p.Options.Cache.Invalidate(inv.API, inv.Version, inv.Key)
+
+	p.logger().Infof("cache of %s:%s key %q invalidated, %d entries removed", inv.API, inv.Version, inv.Key, removed)
+
+	return removed
+}
+
+// subscribeCacheInvalidation invalidates the cache by the messages of
+// Options.CacheInvalidationTopic
+func (p *PostAPI) subscribeCacheInvalidation() (err error) {
+	if p.Options.CacheInvalidationTopic == "" || p.Options.Broker == nil {
+		return
+	}
+
+	_, err = p.Options.Broker.Subscribe(p.Options.CacheInvalidationTopic, func(pub broker.Publication) error {
+		var inv CacheInvalidation
+		if e := json.Unmarshal(pub.Message().Body, &inv); e != nil {
+			p.logger().Warnf("invalid cache invalidation message: %s", e)
+			return nil
+		}
+
+		p.invalidateCache(inv)
+
+		return nil
+	})
+
+	return
+}
+
+// adminInvalidateCacheHandle removes the cached results of an api, use * as
+// version for all versions and the key query parameter for one key
+func (p *PostAPI) adminInvalidateCacheHandle(c echo.Context) (err error) {
+	version := c.Param("version")
+	if version == "*" {
+		version = ""
+	}
+
+	removed := p.invalidateCache(CacheInvalidation{API: c.Param("api"), Version: version, Key: c.QueryParam("key")})
+
+	return c.JSON(http.StatusOK, map[string]int{"removed": removed})
+}
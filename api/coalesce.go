@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/micro/go-micro/metadata"
+	"golang.org/x/net/context"
+)
+
+// coalescedCall is a backend call shared by the identical sub-calls arriving
+// while it is in flight
+type coalescedCall struct {
+	done chan struct{}
+	resp PostAPIResponse
+}
+
+// coalesceGroup is a singleflight group of backend calls
+type coalesceGroup struct {
+	locker sync.Mutex
+	calls  map[string]*coalescedCall
+}
+
+// do calls fn once for all the concurrent callers with the same key, shared
+// is true for the callers receiving the result of another caller
+func (p *coalesceGroup) do(key string, fn func() PostAPIResponse) (resp PostAPIResponse, shared bool) {
+	p.locker.Lock()
+
+	if call, exist := p.calls[key]; exist {
+		p.locker.Unlock()
+
+		<-call.done
+
+		return call.resp, true
+	}
+
+	call := &coalescedCall{done: make(chan struct{})}
+	p.calls[key] = call
+
+	p.locker.Unlock()
+
+	defer func() {
+		p.locker.Lock()
+		delete(p.calls, key)
+		p.locker.Unlock()
+
+		close(call.done)
+	}()
+
+	call.resp = fn()
+
+	return call.resp, false
+}
+
+func isCoalesced(metadata map[string]string) bool {
+	v, _ := strconv.ParseBool(metadata[helper.APICoalesceMetadataKey])
+	return v
+}
+
+// coalesceKey identifies identical sub-calls by the api, the resolved
+// version, the backend method, the content, the labels and the forwarded
+// Options.MicroHeaders, the per-request metadata like Client-IP, Cookies or
+// Request-Id is left out. They are marshalled to json which sorts the map
+// keys, so the same parameters in any order give the same key.
+func (p *PostAPI) coalesceKey(ctx context.Context, api, version string, srv microService, content map[string]interface{}, labels map[string]string) (key string, err error) {
+	md, _ := metadata.FromContext(ctx)
+
+	headers := make(map[string]string)
+	for _, name := range p.Options.MicroHeaders {
+		if value, exist := md[name]; exist {
+			headers[name] = value
+		}
+	}
+
+	var data []byte
+	if data, err = json.Marshal([]interface{}{api, version, srv.Service, srv.Method, content, labels, headers}); err != nil {
+		return
+	}
+
+	key = string(data)
+
+	return
+}
+
+// coalesce shares one backend call between the concurrent identical
+// sub-calls of the apis marked by helper.Coalesced
+func (p *PostAPI) coalesce(ctx context.Context, api, version string, srv microService, content map[string]interface{}, labels map[string]string, fn func() PostAPIResponse) PostAPIResponse {
+	if !isCoalesced(srv.Metadata) {
+		return fn()
+	}
+
+	key, err := p.coalesceKey(ctx, api, version, srv, content, labels)
+	if err != nil {
+		return fn()
+	}
+
+	p.metrics.Add("coalesce_calls", 1)
+
+	resp, shared := p.coalesceGroup.do(key, fn)
+	if shared {
+		p.metrics.Add("coalesce_shared", 1)
+	} else {
+		p.metrics.Add("coalesce_backend_calls", 1)
+	}
+
+	return resp
+}
+
+// coalesceRatio is the ratio of the sub-calls answered by a shared backend
+// call
+func (p *PostAPI) coalesceRatio() interface{} {
+	calls, _ := p.metrics.Get("coalesce_calls").(*expvar.Int)
+	shared, _ := p.metrics.Get("coalesce_shared").(*expvar.Int)
+
+	if calls == nil || shared == nil || calls.Value() == 0 {
+		return float64(0)
+	}
+
+	return float64(shared.Value()) / float64(calls.Value())
+}
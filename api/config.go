@@ -0,0 +1,463 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/micro/go-micro/broker"
+	"github.com/micro/go-micro/registry"
+	"github.com/micro/go-micro/selector"
+)
+
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+type TopicConfig struct {
+	EnableRequest  bool   `json:"enable_request"`
+	EnableResponse bool   `json:"enable_response"`
+	Request        string `json:"request"`
+	Response       string `json:"response"`
+	Mirror         string `json:"mirror"`
+}
+
+type AdminConfig struct {
+	Path  string `json:"path"`
+	Token string `json:"token"`
+}
+
+type SelectorConfig struct {
+	// Strategy is random (the go-micro default selector) or latency
+	Strategy      string  `json:"strategy"`
+	Alpha         float64 `json:"alpha"`
+	EjectErrors   int     `json:"eject_errors"`
+	EjectDuration string  `json:"eject_duration"`
+}
+
+type HedgeConfig struct {
+	Delay     string  `json:"delay"`
+	Budget    float64 `json:"budget"`
+	MaxTokens float64 `json:"max_tokens"`
+}
+
+type CacheConfig struct {
+	Size              int    `json:"size"`
+	InvalidationTopic string `json:"invalidation_topic"`
+}
+
+type IdempotencyConfig struct {
+	Window string `json:"window"`
+	Size   int    `json:"size"`
+}
+
+type RecordConfig struct {
+	File    string   `json:"file"`
+	Redact  []string `json:"redact"`
+	Sample  float64  `json:"sample"`
+	Buffer  int      `json:"buffer"`
+	MaxSize int64    `json:"max_size"`
+}
+
+type Config struct {
+	Address         string            `json:"address"`
+	Path            string            `json:"path"`
+	BodyLimit       string            `json:"body_limit"`
+	Engine          string            `json:"engine"`
+	TLS             TLSConfig         `json:"tls"`
+	MicroTLS        TLSConfig         `json:"micro_tls"`
+	CORS            *CORSOptions      `json:"cors"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	MicroHeaders    []string          `json:"micro_headers"`
+	Topic           TopicConfig       `json:"topic"`
+
+	RegistryAddresses []string       `json:"registry_addresses"`
+	BrokerAddresses   []string       `json:"broker_addresses"`
+	Selector          SelectorConfig `json:"selector"`
+
+	RouteFile         string `json:"route_file"`
+	RouteFileInterval string `json:"route_file_interval"`
+
+	SnapshotFile string `json:"snapshot_file"`
+	FixtureFile  string `json:"fixture_file"`
+
+	Record RecordConfig `json:"record"`
+
+	MaintenanceFile string `json:"maintenance_file"`
+
+	Admin AdminConfig `json:"admin"`
+
+	NodeLabelCallers []string `json:"node_label_callers"`
+
+	Hedge HedgeConfig `json:"hedge"`
+	Cache CacheConfig `json:"cache"`
+
+	Idempotency IdempotencyConfig `json:"idempotency"`
+
+	RejectSunsetAPIs bool   `json:"reject_sunset_apis"`
+	ClientIDHeader   string `json:"client_id_header"`
+
+	LogLevel string `json:"log_level"`
+}
+
+func LoadConfig(filename string) (conf *Config, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	var c Config
+	if err = json.Unmarshal(data, &c); err != nil {
+		err = fmt.Errorf("parse config %s failed: %s", filename, err)
+		return
+	}
+
+	conf = &c
+
+	return
+}
+
+// Validate returns all problems found in the config, it returns nil when the
+// config could be used to start the gateway.
+func (p *Config) Validate() (errs []error) {
+	if strings.TrimSpace(p.Address) == "" {
+		errs = append(errs, fmt.Errorf("address is empty"))
+	}
+
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		errs = append(errs, fmt.Errorf("path %q should start with /", p.Path))
+	}
+
+	if _, err := parseEngine(p.Engine); err != nil {
+		errs = append(errs, err)
+	}
+
+	if (p.TLS.CertFile == "") != (p.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls cert_file and key_file should be set together"))
+	}
+
+	if (p.MicroTLS.CertFile == "") != (p.MicroTLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("micro_tls cert_file and key_file should be set together"))
+	}
+
+	if p.BodyLimit != "" {
+		if _, err := parseBodyLimit(p.BodyLimit); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if p.LogLevel != "" {
+		if _, err := logrus.ParseLevel(p.LogLevel); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if p.Admin.Path != "" && !strings.HasPrefix(p.Admin.Path, "/") {
+		errs = append(errs, fmt.Errorf("admin path %q should start with /", p.Admin.Path))
+	}
+
+	if p.Admin.Path != "" && p.Admin.Token == "" {
+		errs = append(errs, fmt.Errorf("admin token should be set with admin path %q", p.Admin.Path))
+	}
+
+	switch p.Selector.Strategy {
+	case "", "random", LatencyStrategy:
+	default:
+		errs = append(errs, fmt.Errorf("unknown selector strategy %q, should be random or latency", p.Selector.Strategy))
+	}
+
+	if _, err := parseDuration("selector.eject_duration", p.Selector.EjectDuration); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := parseCallers(p.NodeLabelCallers); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := parseDuration("hedge.delay", p.Hedge.Delay); err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Hedge.Budget < 0 || p.Hedge.Budget > 1 {
+		errs = append(errs, fmt.Errorf("hedge budget %v should be between 0 and 1", p.Hedge.Budget))
+	}
+
+	if p.Cache.Size < 0 {
+		errs = append(errs, fmt.Errorf("cache size %d should not be negative", p.Cache.Size))
+	}
+
+	if _, err := parseDuration("idempotency.window", p.Idempotency.Window); err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Idempotency.Size < 0 {
+		errs = append(errs, fmt.Errorf("idempotency size %d should not be negative", p.Idempotency.Size))
+	}
+
+	if p.Record.Sample < 0 || p.Record.Sample > 1 {
+		errs = append(errs, fmt.Errorf("record sample %v should be between 0 and 1", p.Record.Sample))
+	}
+
+	if p.Record.Buffer < 0 || p.Record.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("record buffer and max_size should not be negative"))
+	}
+
+	if p.RouteFile != "" {
+		if routeFile, err := LoadStaticRoutes(p.RouteFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			for _, e := range routeFile.Validate() {
+				errs = append(errs, fmt.Errorf("route file %s: %s", p.RouteFile, e))
+			}
+		}
+	}
+
+	if p.FixtureFile != "" {
+		if fixtures, err := LoadFixtures(p.FixtureFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			for _, e := range fixtures.Validate() {
+				errs = append(errs, fmt.Errorf("fixture file %s: %s", p.FixtureFile, e))
+			}
+		}
+	}
+
+	if p.MaintenanceFile != "" {
+		if maintenance, err := LoadMaintenance(p.MaintenanceFile); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		} else if err == nil {
+			for i, s := range maintenance.Switches {
+				for _, e := range s.Validate() {
+					errs = append(errs, fmt.Errorf("maintenance file %s: switches[%d]: %s", p.MaintenanceFile, i, e))
+				}
+			}
+		}
+	}
+
+	if _, err := parseDuration("route_file_interval", p.RouteFileInterval); err != nil {
+		errs = append(errs, err)
+	}
+
+	return
+}
+
+// Options converts the config into gateway options, the config should be
+// validated before.
+func (p *Config) Options() (opts []Option) {
+	if p.Address != "" {
+		opts = append(opts, Address(p.Address))
+	}
+
+	if p.Path != "" {
+		opts = append(opts, Path(p.Path))
+	} else {
+		opts = append(opts, Path(DefaultPath))
+	}
+
+	if p.BodyLimit != "" {
+		opts = append(opts, BodyLimit(p.BodyLimit))
+	}
+
+	if engine, err := parseEngine(p.Engine); err == nil {
+		opts = append(opts, Engine(engine))
+	}
+
+	if p.TLS.CertFile != "" {
+		opts = append(opts, TLSOptions(p.TLS.CertFile, p.TLS.KeyFile))
+	}
+
+	if p.MicroTLS.CertFile != "" {
+		opts = append(opts, MicroTLSOptions(p.MicroTLS.CertFile, p.MicroTLS.KeyFile))
+	}
+
+	if p.CORS != nil {
+		opts = append(opts, CORS(*p.CORS))
+	}
+
+	for key, val := range p.ResponseHeaders {
+		opts = append(opts, ResponseHeader(key, val))
+	}
+
+	if len(p.MicroHeaders) > 0 {
+		opts = append(opts, MicroHeaders(p.MicroHeaders...))
+	}
+
+	opts = append(opts,
+		EnableRequestTopic(p.Topic.EnableRequest),
+		EnableResponseTopic(p.Topic.EnableResponse),
+		Topic(p.Topic.Request, p.Topic.Response),
+	)
+
+	reg := registry.DefaultRegistry
+	if len(p.RegistryAddresses) > 0 {
+		reg = registry.NewRegistry(registry.Addrs(p.RegistryAddresses...))
+		opts = append(opts, MicroRegistry(reg))
+	}
+
+	if p.Selector.Strategy == LatencyStrategy {
+		ejectDuration, _ := parseDuration("selector.eject_duration", p.Selector.EjectDuration)
+
+		latencyOpts := LatencySelectorOptions{
+			Alpha:         p.Selector.Alpha,
+			EjectErrors:   p.Selector.EjectErrors,
+			EjectDuration: ejectDuration,
+		}
+
+		opts = append(opts, MicroSelector(NewLatencySelector(latencyOpts, selector.Registry(reg))))
+	}
+
+	if len(p.BrokerAddresses) > 0 {
+		opts = append(opts, MicroBroker(broker.NewBroker(broker.Addrs(p.BrokerAddresses...))))
+	}
+
+	if p.RouteFile != "" {
+		interval, _ := parseDuration("route_file_interval", p.RouteFileInterval)
+		opts = append(opts, RouteFile(p.RouteFile, interval))
+	}
+
+	if p.SnapshotFile != "" {
+		opts = append(opts, SnapshotFile(p.SnapshotFile))
+	}
+
+	if p.FixtureFile != "" {
+		opts = append(opts, FixtureFile(p.FixtureFile))
+	}
+
+	if p.MaintenanceFile != "" {
+		opts = append(opts, MaintenanceFile(p.MaintenanceFile))
+	}
+
+	if p.Record.File != "" {
+		opts = append(opts, Record(RecordOptions{
+			File:    p.Record.File,
+			Redact:  p.Record.Redact,
+			Sample:  p.Record.Sample,
+			Buffer:  p.Record.Buffer,
+			MaxSize: p.Record.MaxSize,
+		}))
+	}
+
+	if p.Admin.Path != "" {
+		opts = append(opts, Admin(p.Admin.Path, p.Admin.Token))
+	}
+
+	if len(p.NodeLabelCallers) > 0 {
+		opts = append(opts, NodeLabelCallers(p.NodeLabelCallers...))
+	}
+
+	if p.Hedge != (HedgeConfig{}) {
+		delay, _ := parseDuration("hedge.delay", p.Hedge.Delay)
+		opts = append(opts, Hedge(HedgeOptions{Delay: delay, Budget: p.Hedge.Budget, MaxTokens: p.Hedge.MaxTokens}))
+	}
+
+	if p.Cache.Size > 0 {
+		opts = append(opts, ResponseCache(NewLRUCache(p.Cache.Size)))
+	}
+
+	if p.Topic.Mirror != "" {
+		opts = append(opts, MirrorTopic(p.Topic.Mirror))
+	}
+
+	if p.Cache.InvalidationTopic != "" {
+		opts = append(opts, CacheInvalidationTopic(p.Cache.InvalidationTopic))
+	}
+
+	if p.Idempotency != (IdempotencyConfig{}) {
+		var store IdempotencyStore
+		if p.Idempotency.Size > 0 {
+			store = NewMemoryIdempotencyStore(p.Idempotency.Size)
+		}
+
+		window, _ := parseDuration("idempotency.window", p.Idempotency.Window)
+		opts = append(opts, Idempotency(store, window))
+	}
+
+	if p.RejectSunsetAPIs {
+		opts = append(opts, RejectSunsetAPIs(true))
+	}
+
+	if p.ClientIDHeader != "" {
+		opts = append(opts, ClientIDHeader(p.ClientIDHeader))
+	}
+
+	if p.LogLevel != "" {
+		if level, err := logrus.ParseLevel(p.LogLevel); err == nil {
+			logger := logrus.New()
+			logger.Level = level
+			opts = append(opts, Logger(logger))
+		}
+	}
+
+	return
+}
+
+func parseEngine(name string) (engine EchoEngine, err error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "standard":
+		engine = Standard
+	case "fasthttp":
+		engine = Fasthttp
+	default:
+		err = fmt.Errorf("unknown engine %q, should be standard or fasthttp", name)
+	}
+
+	return
+}
+
+func parseDuration(name, value string) (d time.Duration, err error) {
+	if value == "" {
+		return
+	}
+
+	if d, err = time.ParseDuration(value); err != nil {
+		err = fmt.Errorf("invalid %s %q: %s", name, value, err)
+	}
+
+	return
+}
+
+func parseBodyLimit(size string) (limit int64, err error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+
+	units := map[string]int64{
+		"B": 1,
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+		"P": 1 << 50,
+	}
+
+	for i := 0; i < len(size); i++ {
+		if size[i] < '0' || size[i] > '9' {
+			multiple, exist := units[strings.TrimSuffix(size[i:], "B")]
+			if !exist {
+				multiple, exist = units[size[i:]]
+			}
+
+			if !exist || i == 0 {
+				err = fmt.Errorf("invalid body_limit %q", size)
+				return
+			}
+
+			var n int64
+			fmt.Sscanf(size[:i], "%d", &n)
+			limit = n * multiple
+			return
+		}
+	}
+
+	if size == "" {
+		err = fmt.Errorf("invalid body_limit %q", size)
+		return
+	}
+
+	fmt.Sscanf(size, "%d", &limit)
+
+	return
+}
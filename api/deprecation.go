@@ -0,0 +1,145 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/engine"
+)
+
+type apiDeprecation struct {
+	Since     time.Time
+	Sunset    time.Time
+	Successor string
+}
+
+// parseDeprecation reads the deprecation metadata written by
+// helper.Deprecated, it returns nil when the api is not deprecated
+func parseDeprecation(metadata map[string]string) *apiDeprecation {
+	deprecated, exist := metadata[helper.APIDeprecatedMetadataKey]
+	if !exist || deprecated == "" || deprecated == "false" {
+		return nil
+	}
+
+	dep := &apiDeprecation{Successor: metadata[helper.APISuccessorMetadataKey]}
+
+	if since, err := time.Parse(time.RFC3339, deprecated); err == nil {
+		dep.Since = since
+	}
+
+	if sunset, err := time.Parse(time.RFC3339, metadata[helper.APISunsetMetadataKey]); err == nil {
+		dep.Sunset = sunset
+	}
+
+	return dep
+}
+
+func (p *apiDeprecation) IsSunset(now time.Time) bool {
+	return !p.Sunset.IsZero() && !now.Before(p.Sunset)
+}
+
+func (p *apiDeprecation) Warning(api, version string) string {
+	warning := fmt.Sprintf("api %s:%s is deprecated", api, version)
+
+	if !p.Sunset.IsZero() {
+		warning += ", sunset at " + p.Sunset.UTC().Format(time.RFC3339)
+	}
+
+	if p.Successor != "" {
+		warning += ", use " + p.Successor + " instead"
+	}
+
+	return warning
+}
+
+// WriteHeaders writes the Deprecation, Sunset (RFC 8594) and Link headers
+func (p *apiDeprecation) WriteHeaders(header engine.Header) {
+	if p.Since.IsZero() {
+		header.Set("Deprecation", "true")
+	} else {
+		header.Set("Deprecation", p.Since.UTC().Format(http.TimeFormat))
+	}
+
+	if !p.Sunset.IsZero() {
+		header.Set("Sunset", p.Sunset.UTC().Format(http.TimeFormat))
+	}
+
+	if p.Successor != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, p.Successor))
+	}
+}
+
+func (p *PostAPI) clientID(c echo.Context) string {
+	if p.Options.ClientIDHeader != "" {
+		if id := strings.TrimSpace(c.Request().Header().Get(p.Options.ClientIDHeader)); id != "" {
+			return id
+		}
+	}
+
+	return p.remoteIP(c)
+}
+
+// countDeprecatedCall counts calls of deprecated apis in the
+// deprecated_calls metric keyed by api:version, and the clients making most
+// of them in deprecated_clients keyed by api:version|client
+func (p *PostAPI) countDeprecatedCall(c echo.Context, api, version string) {
+	key := api + ":" + version
+
+	if calls, ok := p.metrics.Get("deprecated_calls").(*expvar.Map); ok {
+		calls.Add(key, 1)
+	}
+
+	p.deprecatedClients.add(key + "|" + p.clientID(c))
+}
+
+// topCounter keeps the counts of the topCounterSize most frequent keys by the
+// space-saving algorithm: a new key replaces the least counted one and takes
+// over its count, so the counts are upper bounds
+type topCounter struct {
+	locker sync.Mutex
+	keys   map[string]int64
+}
+
+const topCounterSize = 100
+
+func (p *topCounter) add(key string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.keys == nil {
+		p.keys = make(map[string]int64)
+	}
+
+	if _, exist := p.keys[key]; exist || len(p.keys) < topCounterSize {
+		p.keys[key]++
+		return
+	}
+
+	minKey, minCount := "", int64(-1)
+	for k, count := range p.keys {
+		if minCount < 0 || count < minCount {
+			minKey, minCount = k, count
+		}
+	}
+
+	delete(p.keys, minKey)
+	p.keys[key] = minCount + 1
+}
+
+func (p *topCounter) counts() interface{} {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	counts := make(map[string]int64, len(p.keys))
+	for key, count := range p.keys {
+		counts[key] = count
+	}
+
+	return counts
+}
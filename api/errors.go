@@ -12,4 +12,8 @@ var (
 	ErrBadRequest          = errors.TN(ErrNamespace, 400, "")
 	ErrInternalServerError = errors.TN(ErrNamespace, 500, "")
 	ErrRequestTimeout      = errors.TN(ErrNamespace, 408, "request timeout")
+	ErrAPISunset           = errors.TN(ErrNamespace, 410, "api {{.api}}:{{.version}} is sunset")
+	ErrAPIMaintenance      = errors.TN(ErrNamespace, 503, "{{.target}} is under maintenance")
+
+	ErrIdempotencyKeyReused = errors.TN(ErrNamespace, 422, "idempotency key {{.key}} is reused with different content")
 )
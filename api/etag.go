@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// withETag sets the strong ETag of the response, the tag of a cached result
+// is kept so a hit and a miss of the same result have the same tag
+func withETag(resp PostAPIResponse) PostAPIResponse {
+	if resp.ETag != "" && resp.Code == 0 {
+		return resp
+	}
+
+	data, err := json.Marshal([]interface{}{resp.Code, resp.ErrID, resp.ResolvedVersion, resp.Result})
+	if err != nil {
+		return resp
+	}
+
+	resp.ETag = hashETag(data)
+
+	return resp
+}
+
+// multiCallETag is the tag of a multi-call response over the tags of its
+// entries
+func multiCallETag(responses map[string]PostAPIResponse) string {
+	keys := make([]string, 0, len(responses))
+	for key := range responses {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	h := sha1.New()
+	for _, key := range keys {
+		h.Write([]byte(key + "=" + responses[key].ETag + "\n"))
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+func hashETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func quoteETag(tag string) string {
+	if strings.HasPrefix(tag, `"`) && strings.HasSuffix(tag, `"`) && len(tag) > 1 {
+		return tag
+	}
+	return `"` + strings.Replace(tag, `"`, "", -1) + `"`
+}
+
+// etagMatch reports whether the If-None-Match header matches etag, weak tags
+// of the header are compared by their opaque tag
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
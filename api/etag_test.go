@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gogap-micro/post-api/api"
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/gogap-micro/post-api/apitest"
+)
+
+type Article struct {
+	calls int64
+}
+
+func (p *Article) Get(ctx context.Context, req *counterRequest, rsp *counterResponse) error {
+	atomic.AddInt64(&p.calls, 1)
+	return nil
+}
+
+func postAPI(t *testing.T, kit *apitest.Kit, api, ifNoneMatch string) *http.Response {
+	req, err := http.NewRequest("POST", kit.Server.URL+kit.PostAPI.Options.Path+"/v1", bytes.NewBufferString(`{"name":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api", api)
+
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestETagOfCachedResult(t *testing.T) {
+	kit, err := apitest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kit.Close()
+
+	h := &Article{}
+	if err = kit.Handle("article.v1", h,
+		helper.ToHandlerOption(h.Get, "v1", "article.get"),
+		helper.Cacheable(h.Get, time.Minute),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	miss := postAPI(t, kit, "article.get", "")
+	hit := postAPI(t, kit, "article.get", "")
+
+	if hit.Header.Get(api.APICacheHeader) != api.CacheHit {
+		t.Fatalf("second call cache = %q, want %q", hit.Header.Get(api.APICacheHeader), api.CacheHit)
+	}
+
+	etag := miss.Header.Get("ETag")
+	if etag == "" || hit.Header.Get("ETag") != etag {
+		t.Errorf("etag of the hit = %q, want the etag of the miss %q", hit.Header.Get("ETag"), etag)
+	}
+
+	if resp := postAPI(t, kit, "article.get", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match of the cached result: status = %d, want 304", resp.StatusCode)
+	}
+
+	if calls := atomic.LoadInt64(&h.calls); calls != 1 {
+		t.Errorf("backend called %d times, want 1", calls)
+	}
+}
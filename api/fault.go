@@ -0,0 +1,328 @@
+package api
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gogap/errors"
+	"github.com/labstack/echo"
+	"golang.org/x/net/context"
+)
+
+const (
+	DefaultFaultDuration = time.Minute * 5
+)
+
+// FaultRule injects a fault into the calls of an api until it expires. The
+// calls are scoped by Version (empty for all versions), a request Header
+// (with Value, or any value when empty) and Percentage of the matching calls
+// (all of them when 0). Delay is added before the backend is called, Error
+// answers the call instead of the backend and Drop answers nothing so the
+// call times out.
+type FaultRule struct {
+	ID         string      `json:"id"`
+	API        string      `json:"api"`
+	Version    string      `json:"version,omitempty"`
+	Header     string      `json:"header,omitempty"`
+	Value      string      `json:"value,omitempty"`
+	Percentage float64     `json:"percentage,omitempty"`
+	Delay      string      `json:"delay,omitempty"`
+	Error      *FaultError `json:"error,omitempty"`
+	Drop       bool        `json:"drop,omitempty"`
+	Duration   string      `json:"duration,omitempty"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+
+	delay time.Duration
+}
+
+// FaultError is the error injected by a fault rule, Namespace is POST-API
+// when empty
+type FaultError struct {
+	Code      uint64 `json:"code"`
+	Namespace string `json:"namespace,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+func (p *FaultRule) Validate() (errs []error) {
+	if strings.TrimSpace(p.API) == "" {
+		errs = append(errs, fmt.Errorf("api is empty"))
+	}
+
+	if p.Percentage < 0 || p.Percentage > 100 {
+		errs = append(errs, fmt.Errorf("percentage %v should be between 0 and 100", p.Percentage))
+	}
+
+	delay, err := parseDuration("delay", p.Delay)
+	if err != nil {
+		errs = append(errs, err)
+	} else if delay < 0 {
+		errs = append(errs, fmt.Errorf("delay %s should not be negative", p.Delay))
+	}
+
+	if p.Error != nil && p.Error.Code == 0 {
+		errs = append(errs, fmt.Errorf("error code is 0"))
+	}
+
+	if p.Error != nil && p.Drop {
+		errs = append(errs, fmt.Errorf("error and drop could not be set together"))
+	}
+
+	if delay == 0 && p.Error == nil && !p.Drop {
+		errs = append(errs, fmt.Errorf("one of delay, error or drop should be set"))
+	}
+
+	if duration, err := parseDuration("duration", p.Duration); err != nil {
+		errs = append(errs, err)
+	} else if duration < 0 {
+		errs = append(errs, fmt.Errorf("duration %s should not be negative", p.Duration))
+	}
+
+	return
+}
+
+// matches reports whether the rule applies to the call of api resolved to
+// version
+func (p *FaultRule) matches(c echo.Context, api, version string) bool {
+	if p.API != api || (p.Version != "" && p.Version != version) {
+		return false
+	}
+
+	if p.Header != "" {
+		value := c.Request().Header().Get(p.Header)
+		if value == "" || (p.Value != "" && p.Value != value) {
+			return false
+		}
+	}
+
+	return p.Percentage <= 0 || p.Percentage >= 100 || rand.Float64()*100 < p.Percentage
+}
+
+func (p *FaultRule) errorResponse() PostAPIResponse {
+	namespace := p.Error.Namespace
+	if namespace == "" {
+		namespace = ErrNamespace
+	}
+
+	message := p.Error.Message
+	if message == "" {
+		message = "fault injected"
+	}
+
+	return newErrorResponse(errors.NewErrorCode(randomHex(16), p.Error.Code, namespace, message, "", nil))
+}
+
+// AddFault activates a fault rule, it expires after its duration,
+// DefaultFaultDuration when empty
+func (p *PostAPI) AddFault(rule FaultRule) (added FaultRule, err error) {
+	if errs := rule.Validate(); len(errs) > 0 {
+		err = errs[0]
+		return
+	}
+
+	duration, _ := parseDuration("duration", rule.Duration)
+	if duration == 0 {
+		duration = DefaultFaultDuration
+	}
+
+	rule.API = strings.TrimSpace(rule.API)
+	rule.ID = randomHex(8)
+	rule.Duration = duration.String()
+	rule.ExpiresAt = time.Now().Add(duration)
+	rule.delay, _ = parseDuration("delay", rule.Delay)
+
+	p.faultLocker.Lock()
+	p.faults = append(p.faults, &rule)
+	p.faultLocker.Unlock()
+
+	p.logger().WithFields(rule.logFields()).Warn("fault rule added")
+
+	added = rule
+
+	return
+}
+
+// RemoveFault deactivates the fault rule of id, * removes all rules
+func (p *PostAPI) RemoveFault(id string) (removed int) {
+	p.faultLocker.Lock()
+	defer p.faultLocker.Unlock()
+
+	var faults []*FaultRule
+	for _, rule := range p.faults {
+		if id == "*" || rule.ID == id {
+			removed++
+			p.logger().WithFields(rule.logFields()).Warn("fault rule removed")
+			continue
+		}
+		faults = append(faults, rule)
+	}
+
+	p.faults = faults
+
+	return
+}
+
+// Faults returns the active fault rules
+func (p *PostAPI) Faults() (faults []FaultRule) {
+	p.faultLocker.Lock()
+	defer p.faultLocker.Unlock()
+
+	p.expireFaults()
+
+	for _, rule := range p.faults {
+		faults = append(faults, *rule)
+	}
+
+	return
+}
+
+// expireFaults should be called with faultLocker held
+func (p *PostAPI) expireFaults() {
+	now := time.Now()
+
+	var faults []*FaultRule
+	for _, rule := range p.faults {
+		if now.After(rule.ExpiresAt) {
+			p.logger().WithFields(rule.logFields()).Warn("fault rule expired")
+			continue
+		}
+		faults = append(faults, rule)
+	}
+
+	p.faults = faults
+}
+
+// matchFault returns the first active fault rule matching the call, the rules
+// of a version match the calls resolved to it, like v1 requested as latest
+func (p *PostAPI) matchFault(c echo.Context, req PostAPIRequest) (rule *FaultRule) {
+	p.faultLocker.Lock()
+	defer p.faultLocker.Unlock()
+
+	if len(p.faults) == 0 {
+		return
+	}
+
+	p.expireFaults()
+
+	version := req.Version
+	if _, resolved, exist := p.getService(req.API, req.Version); exist {
+		version = resolved
+	}
+
+	for _, r := range p.faults {
+		if r.matches(c, req.API, version) {
+			return r
+		}
+	}
+
+	return
+}
+
+// injectFault applies the fault rule to the call, answered is false when
+// there is no rule or the backend should be called after the delay, and resp
+// is nil when the response is dropped. The delay ends early with a dropped
+// response when ctx is done or the call times out.
+func (p *PostAPI) injectFault(ctx context.Context, timeout time.Duration, rule *FaultRule, req PostAPIRequest) (resp *PostAPIResponse, answered bool) {
+	if rule == nil {
+		return
+	}
+
+	p.metrics.Add("fault_injections", 1)
+
+	p.logger().WithFields(rule.logFields()).
+		WithField("call_api", req.API).
+		WithField("call_version", req.Version).
+		Warn("fault injected")
+
+	if rule.delay > 0 {
+		delay := time.NewTimer(rule.delay)
+		defer delay.Stop()
+
+		expired := time.NewTimer(timeout)
+		defer expired.Stop()
+
+		select {
+		case <-delay.C:
+		case <-expired.C:
+			return nil, true
+		case <-ctx.Done():
+			return nil, true
+		}
+	}
+
+	if rule.Drop {
+		return nil, true
+	}
+
+	if rule.Error != nil {
+		r := rule.errorResponse()
+		return &r, true
+	}
+
+	return
+}
+
+func (p *FaultRule) logFields() logrus.Fields {
+	fields := logrus.Fields{
+		"fault_id":   p.ID,
+		"api":        p.API,
+		"expires_at": p.ExpiresAt.Format(time.RFC3339),
+	}
+
+	if p.Version != "" {
+		fields["version"] = p.Version
+	}
+
+	if p.Header != "" {
+		fields["header"] = p.Header + "=" + p.Value
+	}
+
+	if p.Percentage > 0 {
+		fields["percentage"] = p.Percentage
+	}
+
+	if p.Delay != "" {
+		fields["delay"] = p.Delay
+	}
+
+	if p.Error != nil {
+		namespace := p.Error.Namespace
+		if namespace == "" {
+			namespace = ErrNamespace
+		}
+		fields["error"] = fmt.Sprintf("%s:%d", namespace, p.Error.Code)
+	}
+
+	if p.Drop {
+		fields["drop"] = true
+	}
+
+	return fields
+}
+
+func (p *PostAPI) adminListFaultsHandle(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, p.Faults())
+}
+
+// adminAddFaultHandle activates the fault rule of the body
+func (p *PostAPI) adminAddFaultHandle(c echo.Context) (err error) {
+	var rule FaultRule
+	if err = c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, adminError{Error: err.Error()})
+	}
+
+	var added FaultRule
+	if added, err = p.AddFault(rule); err != nil {
+		return c.JSON(http.StatusBadRequest, adminError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, added)
+}
+
+// adminRemoveFaultHandle deactivates a fault rule, use * as id for all rules
+func (p *PostAPI) adminRemoveFaultHandle(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, map[string]int{"removed": p.RemoveFault(c.Param("id"))})
+}
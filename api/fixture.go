@@ -0,0 +1,378 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	mathRand "math/rand"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/labstack/echo"
+	"golang.org/x/net/context"
+)
+
+var fixtureValueExpr = regexp.MustCompile(`^\{\{\s*\.content((?:\.[\w-]+)+)\s*\}\}$`)
+
+// Fixtures answers the calls of apis from fixtures instead of the backends,
+// the first fixture of an api and version matching the content is used
+type Fixtures struct {
+	Fixtures []Fixture `json:"fixtures"`
+}
+
+// Fixture is a canned response of an api. Version could be empty for all
+// versions. Match lists content fields (nested by dots) the call should
+// have. The string values of Result are templates of the call with
+// .content, .header, .api and .version, a string of only {{.content.<field>}}
+// keeps the type of the field.
+type Fixture struct {
+	API     string                 `json:"api"`
+	Version string                 `json:"version,omitempty"`
+	Match   map[string]interface{} `json:"match,omitempty"`
+	Latency string                 `json:"latency,omitempty"`
+	Jitter  string                 `json:"jitter,omitempty"`
+	Result  interface{}            `json:"result,omitempty"`
+	Error   *FixtureError          `json:"error,omitempty"`
+
+	latency time.Duration
+	jitter  time.Duration
+}
+
+// FixtureError is the error response of a fixture, Namespace is POST-API
+// when empty
+type FixtureError struct {
+	Code      uint64 `json:"code"`
+	Namespace string `json:"namespace,omitempty"`
+	Message   string `json:"message"`
+}
+
+func LoadFixtures(filename string) (fixtures *Fixtures, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	var f Fixtures
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&f); err != nil {
+		err = fmt.Errorf("parse fixtures %s failed: %s", filename, err)
+		return
+	}
+
+	fixtures = &f
+
+	return
+}
+
+// Validate returns all problems found in the fixtures
+func (p *Fixtures) Validate() (errs []error) {
+	for i := range p.Fixtures {
+		fixture := &p.Fixtures[i]
+
+		if strings.TrimSpace(fixture.API) == "" {
+			errs = append(errs, fmt.Errorf("fixture %d: api is empty", i))
+		}
+
+		if fixture.Error != nil && fixture.Error.Code == 0 {
+			errs = append(errs, fmt.Errorf("fixture %d of %s: error code is 0", i, fixture.API))
+		}
+
+		var err error
+		if fixture.latency, err = parseDuration("latency", fixture.Latency); err != nil {
+			errs = append(errs, fmt.Errorf("fixture %d of %s: %s", i, fixture.API, err))
+		}
+
+		if fixture.jitter, err = parseDuration("jitter", fixture.Jitter); err != nil {
+			errs = append(errs, fmt.Errorf("fixture %d of %s: %s", i, fixture.API, err))
+		}
+
+		if err = checkTemplates(fixture.Result); err != nil {
+			errs = append(errs, fmt.Errorf("fixture %d of %s: %s", i, fixture.API, err))
+		}
+	}
+
+	return
+}
+
+func checkTemplates(v interface{}) (err error) {
+	switch value := v.(type) {
+	case string:
+		if strings.Contains(value, "{{") {
+			_, err = template.New("fixture").Option("missingkey=zero").Parse(value)
+		}
+	case map[string]interface{}:
+		for _, field := range value {
+			if err = checkTemplates(field); err != nil {
+				return
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err = checkTemplates(item); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (p *Fixture) matches(version string, content map[string]interface{}) bool {
+	if p.Version != "" && p.Version != version {
+		return false
+	}
+
+	for field, expected := range p.Match {
+		if !equalJSON(expected, contentField(content, field)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contentField returns the value of a field of the content, nested fields are
+// separated by dots
+func contentField(content map[string]interface{}, field string) interface{} {
+	var v interface{} = content
+	for _, name := range strings.Split(strings.Trim(field, "."), ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+type fixtureData struct {
+	API     string
+	Version string
+	Content map[string]interface{}
+	Header  map[string]string
+}
+
+// render executes the templates of the string values of v
+func (p fixtureData) render(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+
+		if m := fixtureValueExpr.FindStringSubmatch(value); m != nil {
+			return contentField(p.Content, m[1]), nil
+		}
+
+		t, err := template.New("fixture").Option("missingkey=zero").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err = t.Execute(&buf, map[string]interface{}{
+			"api":     p.API,
+			"version": p.Version,
+			"content": p.Content,
+			"header":  p.Header,
+		}); err != nil {
+			return nil, err
+		}
+
+		return buf.String(), nil
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			r, err := p.render(field)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			r, err := p.render(item)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, r)
+		}
+		return rendered, nil
+	}
+
+	return v, nil
+}
+
+func (p *PostAPI) loadFixtures() (err error) {
+	var fixtures *Fixtures
+	if fixtures, err = LoadFixtures(p.Options.FixtureFile); err != nil {
+		return
+	}
+
+	if errs := fixtures.Validate(); len(errs) > 0 {
+		err = fmt.Errorf("invalid fixtures %s: %s", p.Options.FixtureFile, errs[0])
+		return
+	}
+
+	table := make(map[string][]*Fixture)
+	for i := range fixtures.Fixtures {
+		fixture := &fixtures.Fixtures[i]
+		api := strings.TrimSpace(fixture.API)
+		table[api] = append(table[api], fixture)
+	}
+
+	p.reglocker.Lock()
+	p.fixtures = table
+	p.reglocker.Unlock()
+
+	return
+}
+
+func (p *PostAPI) watchFixtures() {
+	p.watchFile("fixtures", p.Options.FixtureFile, p.Options.RouteFileInterval, p.loadFixtures)
+}
+
+// apiFixtures returns the fixtures of api, the table is replaced as a whole
+// when the fixtures are reloaded
+func (p *PostAPI) apiFixtures(api string) []*Fixture {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	return p.fixtures[api]
+}
+
+// fixtureVersion resolves the version of a call answered by fixtures like
+// callAPI does, against the versions of the fixtures when the api has no
+// route
+func (p *PostAPI) fixtureVersion(api, version string, fixtures []*Fixture) string {
+	if _, resolved, exist := p.getService(api, version); exist {
+		return resolved
+	}
+
+	var versions []string
+	for _, f := range fixtures {
+		if f.Version != "" {
+			versions = append(versions, f.Version)
+		}
+	}
+
+	if resolved, exist := resolveVersion(version, versions); exist {
+		return resolved
+	}
+
+	return version
+}
+
+// hasFixture reports whether a fixture of the api could answer the version,
+// whatever the content is
+func (p *PostAPI) hasFixture(api, version string) bool {
+	fixtures := p.apiFixtures(api)
+	if len(fixtures) == 0 {
+		return false
+	}
+
+	version = p.fixtureVersion(api, version, fixtures)
+
+	for _, f := range fixtures {
+		if f.Version == "" || f.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// callFixture answers the call from the fixtures of the api, exist is false
+// when no fixture matches so the call is routed to the backend. The latency
+// ends early with a timeout error when ctx is done or the call times out.
+func (p *PostAPI) callFixture(ctx context.Context, c echo.Context, req PostAPIRequest) (resp PostAPIResponse, exist bool) {
+	fixtures := p.apiFixtures(req.API)
+	if len(fixtures) == 0 {
+		return
+	}
+
+	version := p.fixtureVersion(req.API, req.Version, fixtures)
+
+	var fixture *Fixture
+	for _, f := range fixtures {
+		if f.matches(version, req.Content) {
+			fixture, exist = f, true
+			break
+		}
+	}
+
+	if !exist {
+		return
+	}
+
+	p.metrics.Add("fixture_calls", 1)
+
+	if delay := fixture.latency; delay > 0 || fixture.jitter > 0 {
+		if fixture.jitter > 0 {
+			delay += time.Duration(mathRand.Int63n(int64(fixture.jitter) + 1))
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		expired := time.NewTimer(p.getRequestTimeout(c.Request()))
+		defer expired.Stop()
+
+		select {
+		case <-timer.C:
+		case <-expired.C:
+			resp = newErrorResponse(ErrRequestTimeout.New())
+			return
+		case <-ctx.Done():
+			resp = newErrorResponse(ErrRequestTimeout.New())
+			return
+		}
+	}
+
+	resp.ResolvedVersion = version
+	resp.Target = "fixture"
+
+	if e := fixture.Error; e != nil {
+		resp.Code = e.Code
+		resp.Message = e.Message
+		resp.ErrNamespace = e.Namespace
+		resp.ErrID = randomHex(16)
+
+		if resp.ErrNamespace == "" {
+			resp.ErrNamespace = ErrNamespace
+		}
+
+		return
+	}
+
+	header := make(map[string]string)
+	for _, key := range c.Request().Header().Keys() {
+		header[key] = c.Request().Header().Get(key)
+	}
+
+	data := fixtureData{API: req.API, Version: version, Content: req.Content, Header: header}
+
+	result, err := data.render(fixture.Result)
+	if err != nil {
+		resp = newErrorResponse(ErrInternalServerError.New().Append(fmt.Sprintf("render fixture of %s: %s", req.API, err)))
+		return
+	}
+
+	resp.Result = result
+
+	return
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gogap-micro/post-api/api"
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/gogap-micro/post-api/apitest"
+)
+
+const testFixtures = `{
+	"fixtures": [
+		{"api": "user.get", "match": {"id": 0}, "error": {"code": 404, "namespace": "USER", "message": "user not found"}},
+		{"api": "user.get", "match": {"filter": {"ids": [1, 2]}}, "result": {"matched": "filter"}},
+		{"api": "user.get", "result": {"id": "{{.content.id}}", "tags": "{{.content.tags}}", "name": "user {{.content.id}}", "api": "{{.api}}"}},
+		{"api": "counter.count", "match": {"name": "mock"}, "result": {"calls": 0}}
+	]
+}`
+
+func newFixtureKit(t *testing.T) (*apitest.Kit, *Counter, func()) {
+	dir, err := ioutil.TempDir("", "post-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "fixtures.json")
+	if err = ioutil.WriteFile(filename, []byte(testFixtures), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	kit, err := apitest.New(api.FixtureFile(filename))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	h := &Counter{}
+	if err = kit.Handle("counter.v1", h, helper.ToHandlerOption(h.Count, "v1", "counter.count")); err != nil {
+		kit.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return kit, h, func() {
+		kit.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFixtureResults(t *testing.T) {
+	kit, _, closeKit := newFixtureKit(t)
+	defer closeKit()
+
+	cases := []struct {
+		name     string
+		content  map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "nested match",
+			content:  map[string]interface{}{"id": 1, "filter": map[string]interface{}{"ids": []int{1, 2}}},
+			expected: map[string]interface{}{"matched": "filter"},
+		},
+		{
+			name:    "template",
+			content: map[string]interface{}{"id": 7, "tags": []string{"a", "b"}},
+			expected: map[string]interface{}{
+				"id":   float64(7),
+				"tags": []interface{}{"a", "b"},
+				"name": "user 7",
+				"api":  "user.get",
+			},
+		},
+		{
+			name:    "nested match mismatch",
+			content: map[string]interface{}{"id": 8, "filter": map[string]interface{}{"ids": []int{1, 3}}},
+			expected: map[string]interface{}{
+				"id":   float64(8),
+				"tags": nil,
+				"name": "user 8",
+				"api":  "user.get",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		var result map[string]interface{}
+		if err := kit.Call("user.get", c.content, &result); err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("%s: result = %v, want %v", c.name, result, c.expected)
+		}
+	}
+}
+
+func TestFixtureError(t *testing.T) {
+	kit, _, closeKit := newFixtureKit(t)
+	defer closeKit()
+
+	resp, err := kit.Client().CallResponse("user.get", map[string]interface{}{"id": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Code != 404 || resp.ErrNamespace != "USER" || resp.Message != "user not found" {
+		t.Errorf("error = %s:%d %q, want USER:404 \"user not found\"", resp.ErrNamespace, resp.Code, resp.Message)
+	}
+
+	if resp.ErrID == "" {
+		t.Error("error of the fixture has no err_id")
+	}
+}
+
+func TestFixtureFallback(t *testing.T) {
+	kit, h, closeKit := newFixtureKit(t)
+	defer closeKit()
+
+	var rsp counterResponse
+	if err := kit.Call("counter.count", counterRequest{Name: "mock"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := atomic.LoadInt64(&h.calls); calls != 0 {
+		t.Errorf("matched fixture: backend called %d times, want 0", calls)
+	}
+
+	if err := kit.Call("counter.count", counterRequest{Name: "real"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Calls != 1 {
+		t.Errorf("unmatched fixture: calls = %d, want the call routed to the backend", rsp.Calls)
+	}
+}
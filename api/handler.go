@@ -13,25 +13,39 @@ import (
 	"github.com/labstack/echo/engine"
 	"golang.org/x/net/context"
 
+	"github.com/micro/go-micro/client"
 	microErrors "github.com/micro/go-micro/errors"
 	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/selector"
 )
 
 const (
 	APIHeader            = "X-Api"
 	MultiCallHeader      = "X-Api-Multi-Call"
 	APICallTimeoutHeader = "X-Api-Call-Timeout"
+
+	APIResolvedVersionHeader = "X-Api-Resolved-Version"
 )
 
 type PostAPIResponse struct {
 	api               string
 	version           string
 	isSpecificVersion bool
-	Code              uint64      `json:"code"`
-	Message           string      `json:"message,omitempty"`
-	ErrID             string      `json:"err_id,omitempty"`
-	ErrNamespace      string      `json:"err_namespace,omitempty"`
-	Result            interface{} `json:"result"`
+	Code              uint64            `json:"code"`
+	Message           string            `json:"message,omitempty"`
+	ErrID             string            `json:"err_id,omitempty"`
+	ErrNamespace      string            `json:"err_namespace,omitempty"`
+	ResolvedVersion   string            `json:"resolved_version,omitempty"`
+	Warning           string            `json:"warning,omitempty"`
+	Target            string            `json:"target,omitempty"`
+	Cache             string            `json:"cache,omitempty"`
+	ETag              string            `json:"etag,omitempty"`
+	Replayed          bool              `json:"replayed,omitempty"`
+	RetryAfter        int64             `json:"retry_after,omitempty"`
+	Violations        []SchemaViolation `json:"violations,omitempty"`
+	Result            interface{}       `json:"result"`
+
+	deprecation *apiDeprecation
 }
 
 type PostAPIRequest struct {
@@ -94,7 +108,15 @@ func (p *PostAPI) rpcHandle(c echo.Context) (err error) {
 	ctx := requestToContext(c.Request(), p.Options.MicroHeaders, map[string]string{"Content-Type": ct, "Timeout": strTimeout})
 
 	for _, req := range apiRequests.Requests {
-		if _, exist := p.getService(req.API, req.Version); !exist {
+		if p.hasFixture(req.API, req.Version) {
+			continue
+		}
+
+		if _, exist := p.maintenanceSwitch(req.API, req.Version, ""); exist {
+			continue
+		}
+
+		if _, _, exist := p.getService(req.API, req.Version); !exist {
 			badRequest(fmt.Sprintf("api not exist, %s:%v", req.API, req.Version))
 			return
 		}
@@ -105,25 +127,26 @@ func (p *PostAPI) rpcHandle(c echo.Context) (err error) {
 	defer close(responsesChan)
 
 	for _, request := range apiRequests.Requests {
-		go func(ctx context.Context, req PostAPIRequest, responsesChan chan PostAPIResponse) {
+		fault := p.matchFault(c, request)
+
+		go func(ctx context.Context, req PostAPIRequest, fault *FaultRule, responsesChan chan PostAPIResponse) {
 
 			defer func() {
 				recover()
 			}()
 
 			var resp PostAPIResponse
-			if srv, exist := p.getService(req.API, req.Version); !exist {
-				err := ErrBadRequest.New().Append(fmt.Sprintf("api not exist, %s:%v", req.API, req.Version))
-
-				resp = PostAPIResponse{
-					ErrID:        err.Id(),
-					ErrNamespace: err.Namespace(),
-					Message:      err.Error(),
-					Code:         err.Code(),
-				}
 
+			if faultResp, answered := p.injectFault(ctx, callTimeout, fault, req); answered {
+				if faultResp == nil {
+					// dropped, the call times out
+					return
+				}
+				resp = *faultResp
 			} else {
-				resp = p.callMicroService(ctx, srv.Service, srv.Method, req.Content)
+				resp = p.idempotentCall(c, req, apiRequests.IsMultiCall, func(req PostAPIRequest) PostAPIResponse {
+					return p.callAPI(ctx, c, req)
+				})
 			}
 
 			resp.api = req.API
@@ -137,7 +160,7 @@ func (p *PostAPI) rpcHandle(c echo.Context) (err error) {
 			default:
 			}
 
-		}(ctx, request, responsesChan)
+		}(ctx, request, fault, responsesChan)
 	}
 
 	apiResponses := map[string]PostAPIResponse{}
@@ -200,16 +223,56 @@ responseFor:
 		}
 	}
 
-	c.Set(apiRequestsKey, apiResponses)
+	for api, resp := range apiResponses {
+		apiResponses[api] = withETag(resp)
+	}
+
+	c.Set(responseKey, apiResponses)
 
 	var finallyResp PostAPIResponse
+	var etag string
 
 	if apiRequests.IsMultiCall {
 		finallyResp.Code = 0
 		finallyResp.Message = ""
 		finallyResp.Result = apiResponses
+
+		etag = multiCallETag(apiResponses)
 	} else {
 		finallyResp = apiResponses[apiRequests.Requests[0].API]
+		etag = finallyResp.ETag
+
+		if finallyResp.ResolvedVersion != "" {
+			c.Response().Header().Set(APIResolvedVersionHeader, finallyResp.ResolvedVersion)
+		}
+
+		if finallyResp.Target != "" {
+			c.Response().Header().Set(APITargetHeader, finallyResp.Target)
+		}
+
+		if finallyResp.Cache != "" {
+			c.Response().Header().Set(APICacheHeader, finallyResp.Cache)
+		}
+
+		if finallyResp.Replayed {
+			c.Response().Header().Set(IdempotencyReplayedHeader, "true")
+		}
+
+		if finallyResp.RetryAfter > 0 {
+			c.Response().Header().Set("Retry-After", strconv.FormatInt(finallyResp.RetryAfter, 10))
+		}
+
+		if finallyResp.deprecation != nil {
+			finallyResp.deprecation.WriteHeaders(c.Response().Header())
+		}
+	}
+
+	if etag != "" {
+		c.Response().Header().Set("ETag", etag)
+
+		if etagMatch(c.Request().Header().Get("If-None-Match"), etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
 	}
 
 	c.JSON(http.StatusOK, finallyResp)
@@ -217,6 +280,106 @@ responseFor:
 	return
 }
 
+// callAPI routes one api request of a call to its micro service
+func (p *PostAPI) callAPI(ctx context.Context, c echo.Context, req PostAPIRequest) (resp PostAPIResponse) {
+	if resp, exist := p.callFixture(ctx, c, req); exist {
+		return resp
+	}
+
+	srv, resolved, exist := p.getService(req.API, req.Version)
+	if !exist {
+		// the routes of an api under maintenance could be gone with its service
+		if s, exist := p.maintenanceSwitch(req.API, req.Version, ""); exist {
+			p.metrics.Add("maintenance_rejections", 1)
+			return s.errorResponse()
+		}
+
+		return newErrorResponse(ErrBadRequest.New().Append(fmt.Sprintf("api not exist, %s:%v", req.API, req.Version)))
+	}
+
+	dep := parseDeprecation(srv.Metadata)
+	if dep != nil {
+		p.countDeprecatedCall(c, req.API, resolved)
+
+		if p.Options.RejectSunsetAPIs && dep.IsSunset(time.Now()) {
+			resp = newErrorResponse(ErrAPISunset.New(errors.Params{"api": req.API, "version": resolved}))
+			resp.ResolvedVersion = resolved
+			return
+		}
+	}
+
+	target := ""
+	if splitSrv, splitResolved, splitTarget, exist, e := p.routeSplit(c, req.API, resolved); e != nil {
+		resp = newErrorResponse(ErrInternalServerError.New().Append(e))
+		resp.ResolvedVersion = resolved
+		resp.Target = splitTarget
+		return
+	} else if exist {
+		srv, resolved, target = splitSrv, splitResolved, splitTarget
+	}
+
+	if s, exist := p.maintenanceSwitch(req.API, resolved, srv.Service); exist {
+		p.metrics.Add("maintenance_rejections", 1)
+
+		resp = s.errorResponse()
+		resp.ResolvedVersion = resolved
+		resp.Target = target
+		return
+	}
+
+	if violations, e := p.validateContent(srv.Metadata, req.Content); e != nil {
+		p.logger().Warnf("schema of %s:%s is ignored: %s", req.API, resolved, e)
+	} else if len(violations) > 0 {
+		resp = newErrorResponse(ErrBadRequest.New().Append("content does not match the schema"))
+		resp.ResolvedVersion = resolved
+		resp.Target = target
+		resp.Violations = violations
+		return
+	}
+
+	labels, e := p.nodeLabels(c, req.API, resolved)
+	if e != nil {
+		resp = newErrorResponse(ErrBadRequest.New().Append(e))
+		resp.ResolvedVersion = resolved
+		return
+	}
+
+	var filters []nodeFilter
+	if len(labels) > 0 {
+		filters = append(filters, labelsFilter(labels))
+	}
+
+	if filter := p.hashNodeFilter(c, ctx, req.API, resolved, srv.Service, req.Content, filters); filter != nil {
+		filters = append(filters, filter)
+	}
+
+	resp = p.cachedCall(c, ctx, req.API, resolved, srv, req.Content, func() PostAPIResponse {
+		return p.coalesce(ctx, req.API, resolved, srv, req.Content, labels, func() PostAPIResponse {
+			return p.mirrored(c, ctx, req.API, resolved, req.Content, func() PostAPIResponse {
+				return p.callHedged(ctx, req.API, resolved, srv, req.Content, filters)
+			})
+		})
+	})
+	resp.ResolvedVersion = resolved
+	resp.Target = target
+
+	if dep != nil {
+		resp.deprecation = dep
+		resp.Warning = dep.Warning(req.API, resolved)
+	}
+
+	return
+}
+
+func newErrorResponse(errCode errors.ErrCode) PostAPIResponse {
+	return PostAPIResponse{
+		Code:         errCode.Code(),
+		Message:      errCode.Error(),
+		ErrID:        errCode.Id(),
+		ErrNamespace: errCode.Namespace(),
+	}
+}
+
 func (p *PostAPI) errorHandle(err error, c echo.Context) {
 
 	if c.Request().Method() == "POST" {
@@ -246,11 +409,24 @@ func (p *PostAPI) errorHandle(err error, c echo.Context) {
 	}
 }
 
-func (p *PostAPI) callMicroService(ctx context.Context, service, method string, request map[string]interface{}) (response PostAPIResponse) {
+func (p *PostAPI) callMicroService(ctx context.Context, service, method string, request map[string]interface{}, filters ...nodeFilter) (response PostAPIResponse) {
 	var resp map[string]interface{}
 	req := p.Options.Client.NewJsonRequest(service, method, request)
 
-	if err := p.Options.Client.Call(ctx, req, &resp); err != nil {
+	var err error
+	if p.isStale() {
+		// the selector depends on the registry, call the known nodes directly
+		var address string
+		if address, err = p.staleNode(service, filters); err == nil {
+			err = p.Options.Client.CallRemote(ctx, address, req, &resp)
+		}
+	} else if len(filters) > 0 {
+		err = p.Options.Client.Call(ctx, req, &resp, client.WithSelectOption(selector.WithFilter(selectorFilter(filters))))
+	} else {
+		err = p.Options.Client.Call(ctx, req, &resp)
+	}
+
+	if err != nil {
 
 		switch e := err.(type) {
 		case *microErrors.Error:
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/micro/go-micro/metadata"
+	"github.com/micro/go-micro/registry"
+	"golang.org/x/net/context"
+)
+
+const (
+	hashRingReplicas = 160
+)
+
+// HashKey routes the calls of an api with the same key to the same node of
+// the service by a consistent hash ring, Key is content:<field>,
+// header:<name> or metadata:<key>, nested content fields are separated by
+// dots. Version could be empty for all versions of the api.
+type HashKey struct {
+	API     string `json:"api"`
+	Version string `json:"version,omitempty"`
+	Key     string `json:"key"`
+}
+
+type hashKeySource struct {
+	Source string
+	Name   string
+}
+
+func parseHashKey(key string) (source hashKeySource, err error) {
+	return parseKeySource("hash key", key)
+}
+
+// parseKeySource parses content:<field>, header:<name> or metadata:<key>,
+// kind names the key in the error
+func parseKeySource(kind, key string) (source hashKeySource, err error) {
+	kv := strings.SplitN(strings.TrimSpace(key), ":", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		err = fmt.Errorf("invalid %s %q, should be content:<field>, header:<name> or metadata:<key>", kind, key)
+		return
+	}
+
+	switch kv[0] {
+	case "content", "header", "metadata":
+		source = hashKeySource{Source: kv[0], Name: kv[1]}
+	default:
+		err = fmt.Errorf("invalid %s %q, should be content:<field>, header:<name> or metadata:<key>", kind, key)
+	}
+
+	return
+}
+
+// value extracts the hash value of a call, it is empty when the call has no
+// such value
+func (p hashKeySource) value(c echo.Context, ctx context.Context, content map[string]interface{}) string {
+	switch p.Source {
+	case "header":
+		return c.Request().Header().Get(p.Name)
+	case "metadata":
+		if md, ok := metadata.FromContext(ctx); ok {
+			return md[p.Name]
+		}
+	case "content":
+		var v interface{} = content
+		for _, field := range strings.Split(p.Name, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			v = m[field]
+		}
+
+		switch value := v.(type) {
+		case nil:
+			return ""
+		case string:
+			return value
+		case json.Number:
+			return value.String()
+		default:
+			data, _ := json.Marshal(value)
+			return string(data)
+		}
+	}
+
+	return ""
+}
+
+type hashRing struct {
+	hashes []uint32
+	nodes  map[uint32]*registry.Node
+}
+
+func newHashRing(nodes map[string]*registry.Node) *hashRing {
+	ring := &hashRing{nodes: make(map[uint32]*registry.Node, len(nodes)*hashRingReplicas)}
+
+	for id, node := range nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(id + "#" + strconv.Itoa(i)))
+			if _, exist := ring.nodes[h]; exist {
+				continue
+			}
+			ring.nodes[h] = node
+			ring.hashes = append(ring.hashes, h)
+		}
+	}
+
+	sort.Sort(uint32Slice(ring.hashes))
+
+	return ring
+}
+
+// Get walks the ring from the hash of key and returns the first node matching
+// the filters
+func (p *hashRing) Get(key string, filters []nodeFilter) (node *registry.Node, exist bool) {
+	if len(p.hashes) == 0 {
+		return
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(p.hashes), func(i int) bool { return p.hashes[i] >= h })
+
+	for i := 0; i < len(p.hashes); i++ {
+		n := p.nodes[p.hashes[(start+i)%len(p.hashes)]]
+		if matchNode(n, filters) {
+			return n, true
+		}
+	}
+
+	return
+}
+
+type uint32Slice []uint32
+
+func (p uint32Slice) Len() int           { return len(p) }
+func (p uint32Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p uint32Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// rebuildHashRing rebuilds the ring of service from the known nodes, it
+// should be called with reglocker held
+func (p *PostAPI) rebuildHashRing(service string) {
+	nodes, exist := p.serviceNodes[service]
+	if !exist || len(nodes) == 0 {
+		delete(p.hashRings, service)
+		return
+	}
+
+	p.hashRings[service] = newHashRing(nodes)
+}
+
+func (p *PostAPI) rebuildHashRings() {
+	p.hashRings = make(map[string]*hashRing, len(p.serviceNodes))
+
+	for service := range p.serviceNodes {
+		p.rebuildHashRing(service)
+	}
+}
+
+// hashNodeFilter pins the call to the node owning its hash key, it returns
+// nil when the api has no hash key or the call has no key value
+func (p *PostAPI) hashNodeFilter(c echo.Context, ctx context.Context, api, version, service string, content map[string]interface{}, filters []nodeFilter) nodeFilter {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	hk, exist := p.hashKeys[splitKey(api, version)]
+	if !exist {
+		if hk, exist = p.hashKeys[splitKey(api, "")]; !exist {
+			return nil
+		}
+	}
+
+	source, err := parseHashKey(hk.Key)
+	if err != nil {
+		return nil
+	}
+
+	value := source.value(c, ctx, content)
+	if value == "" {
+		return nil
+	}
+
+	ring, exist := p.hashRings[service]
+	if !exist {
+		return nil
+	}
+
+	node, exist := ring.Get(value, filters)
+	if !exist {
+		return nil
+	}
+
+	return nodeIDFilter(node.Id)
+}
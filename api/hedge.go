@@ -0,0 +1,290 @@
+package api
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/micro/go-micro/registry"
+	"golang.org/x/net/context"
+)
+
+const (
+	latencySamples    = 256
+	minLatencySamples = 20
+)
+
+type HedgeOptions struct {
+	// Delay is how long to wait for the first call before sending the hedged
+	// call, it is used when the api declares no delay of its own
+	Delay time.Duration
+	// Budget is the ratio of hedged calls to hedgeable calls, 0.1 allows one
+	// hedged call per ten calls at most
+	Budget float64
+	// MaxTokens is how many hedged calls could be saved up in quiet times
+	MaxTokens float64
+}
+
+var DefaultHedgeOptions = HedgeOptions{
+	Delay:     time.Millisecond * 50,
+	Budget:    0.1,
+	MaxTokens: 10,
+}
+
+type hedgePolicy struct {
+	Delay      time.Duration
+	Percentile float64
+}
+
+// parseHedgePolicy reads the hedge metadata written by helper.Hedgeable: true
+// uses the default delay, a duration like 30ms is a fixed delay, and p95 waits
+// for the 95th percentile of the recent latencies of the api
+func parseHedgePolicy(metadata map[string]string) (policy hedgePolicy, exist bool) {
+	value := strings.TrimSpace(metadata[helper.APIHedgeMetadataKey])
+
+	switch {
+	case value == "" || value == "false":
+		return
+	case value == "true":
+	case strings.HasPrefix(value, "p"):
+		percentile, err := strconv.ParseFloat(value[1:], 64)
+		if err != nil || percentile <= 0 || percentile >= 100 {
+			return
+		}
+		policy.Percentile = percentile
+	default:
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay <= 0 {
+			return
+		}
+		policy.Delay = delay
+	}
+
+	exist = true
+
+	return
+}
+
+// hedgeBudget is a token bucket filled by every hedgeable call, a hedged
+// call takes one token so hedging could not double the load in incidents
+type hedgeBudget struct {
+	locker sync.Mutex
+	tokens float64
+}
+
+func (p *hedgeBudget) deposit(amount, max float64) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.tokens += amount; p.tokens > max {
+		p.tokens = max
+	}
+}
+
+func (p *hedgeBudget) withdraw() bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.tokens < 1 {
+		return false
+	}
+
+	p.tokens--
+
+	return true
+}
+
+// latencyWindow keeps the recent latencies of an api
+type latencyWindow struct {
+	locker  sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (p *latencyWindow) add(d time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if len(p.samples) < latencySamples {
+		p.samples = append(p.samples, d)
+		return
+	}
+
+	p.samples[p.next] = d
+	p.next = (p.next + 1) % latencySamples
+}
+
+func (p *latencyWindow) percentile(percentile float64) (d time.Duration, exist bool) {
+	p.locker.Lock()
+	samples := make([]time.Duration, len(p.samples))
+	copy(samples, p.samples)
+	p.locker.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return
+	}
+
+	sort.Sort(durationSlice(samples))
+
+	i := int(float64(len(samples))*percentile/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(samples) {
+		i = len(samples) - 1
+	}
+
+	return samples[i], true
+}
+
+type durationSlice []time.Duration
+
+func (p durationSlice) Len() int           { return len(p) }
+func (p durationSlice) Less(i, j int) bool { return p[i] < p[j] }
+func (p durationSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func (p *PostAPI) apiLatency(api, version string) *latencyWindow {
+	key := api + ":" + version
+
+	p.latencyLocker.Lock()
+	defer p.latencyLocker.Unlock()
+
+	window, exist := p.latencies[key]
+	if !exist {
+		window = &latencyWindow{}
+		p.latencies[key] = window
+	}
+
+	return window
+}
+
+func (p *PostAPI) hedgeDelay(api, version string, policy hedgePolicy) time.Duration {
+	if policy.Percentile > 0 {
+		if d, exist := p.apiLatency(api, version).percentile(policy.Percentile); exist {
+			return d
+		}
+	}
+
+	if policy.Delay > 0 {
+		return policy.Delay
+	}
+
+	if p.Options.Hedge.Delay > 0 {
+		return p.Options.Hedge.Delay
+	}
+
+	return DefaultHedgeOptions.Delay
+}
+
+// hedgeNodes picks two different nodes of service matching the filters
+func (p *PostAPI) hedgeNodes(service string, filters []nodeFilter) (primary, secondary *registry.Node, exist bool) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	var nodes []*registry.Node
+	for _, node := range p.serviceNodes[service] {
+		if matchNode(node, filters) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	if len(nodes) < 2 {
+		return
+	}
+
+	i := rand.Intn(len(nodes))
+	j := rand.Intn(len(nodes) - 1)
+	if j == i {
+		j = len(nodes) - 1
+	}
+
+	return nodes[i], nodes[j], true
+}
+
+type hedgeResult struct {
+	resp   PostAPIResponse
+	hedged bool
+}
+
+// callHedged calls the service like callMicroService, for apis marked as
+// hedgeable a second call is sent to another node when the first one did not
+// answer after the hedge delay. The first successful response wins and the
+// other call is cancelled.
+func (p *PostAPI) callHedged(ctx context.Context, api, version string, srv microService, request map[string]interface{}, filters []nodeFilter) (response PostAPIResponse) {
+	policy, hedgeable := parseHedgePolicy(srv.Metadata)
+	if !hedgeable || p.isStale() {
+		return p.callMicroService(ctx, srv.Service, srv.Method, request, filters...)
+	}
+
+	budget := p.Options.Hedge.Budget
+	if budget <= 0 {
+		budget = DefaultHedgeOptions.Budget
+	}
+
+	maxTokens := p.Options.Hedge.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultHedgeOptions.MaxTokens
+	}
+
+	p.hedgeBudget.deposit(budget, maxTokens)
+
+	primary, secondary, exist := p.hedgeNodes(srv.Service, filters)
+	if !exist {
+		return p.callMicroService(ctx, srv.Service, srv.Method, request, filters...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+
+	call := func(node *registry.Node, hedged bool) {
+		// the calls run concurrently, each one gets its own copy of filters
+		nodeFilters := append(filters[:len(filters):len(filters)], nodeIDFilter(node.Id))
+
+		start := time.Now()
+		resp := p.callMicroService(ctx, srv.Service, srv.Method, request, nodeFilters...)
+		if resp.Code == 0 {
+			p.apiLatency(api, version).add(time.Since(start))
+		}
+		results <- hedgeResult{resp: resp, hedged: hedged}
+	}
+
+	go call(primary, false)
+
+	timer := time.NewTimer(p.hedgeDelay(api, version, policy))
+	defer timer.Stop()
+
+	pending := 1
+
+	select {
+	case result := <-results:
+		return result.resp
+	case <-timer.C:
+	}
+
+	if p.hedgeBudget.withdraw() {
+		p.metrics.Add("hedged_calls", 1)
+		pending++
+		go call(secondary, true)
+	} else {
+		p.metrics.Add("hedge_budget_exhausted", 1)
+	}
+
+	for ; pending > 0; pending-- {
+		result := <-results
+		response = result.resp
+
+		if response.Code == 0 {
+			if result.hedged {
+				p.metrics.Add("hedge_wins", 1)
+			}
+			return
+		}
+	}
+
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/micro/go-micro/server"
 )
@@ -13,6 +14,16 @@ import (
 const (
 	APIMetadataKey    = "post_api"
 	APIVerMetadataKey = "post_api_ver"
+
+	APIDeprecatedMetadataKey = "post_api_deprecated"
+	APISunsetMetadataKey     = "post_api_sunset"
+	APISuccessorMetadataKey  = "post_api_successor"
+
+	APIHedgeMetadataKey    = "post_api_hedge"
+	APICoalesceMetadataKey = "post_api_coalesce"
+
+	APICacheTTLMetadataKey  = "post_api_cache_ttl"
+	APICacheKeysMetadataKey = "post_api_cache_keys"
 )
 
 const (
@@ -43,14 +54,93 @@ func ToHandlerOption(fn interface{}, ver, api string, alias ...string) server.Ha
 
 	strAPIs := strings.Join(apis, ",")
 
-	if name, err := FuncName(fn); err != nil {
+	return withMetadata(fn, map[string]string{APIMetadataKey: strAPIs, APIVerMetadataKey: ver})
+}
+
+// Deprecated marks the api of fn as deprecated since the time it was
+// deprecated, the gateway warns the clients and rejects the calls after sunset
+// when configured. since and sunset could be zero, successor is the version or
+// uri the clients should move to.
+func Deprecated(fn interface{}, since, sunset time.Time, successor string) server.HandlerOption {
+	if fn == nil {
 		return nilHandlerOption
-	} else {
-		return func(o *server.HandlerOptions) {
-			o.Metadata[name] = map[string]string{APIMetadataKey: strAPIs, APIVerMetadataKey: ver}
-		}
 	}
 
+	metadata := map[string]string{
+		APIDeprecatedMetadataKey: "true",
+		APISuccessorMetadataKey:  strings.TrimSpace(successor),
+	}
+
+	if !since.IsZero() {
+		metadata[APIDeprecatedMetadataKey] = since.UTC().Format(time.RFC3339)
+	}
+
+	if !sunset.IsZero() {
+		metadata[APISunsetMetadataKey] = sunset.UTC().Format(time.RFC3339)
+	}
+
+	return withMetadata(fn, metadata)
+}
+
+// Hedgeable marks the api of fn as safe to call twice, the gateway sends a
+// hedged call to another node when the first one is slow. delay is a duration
+// like 30ms, a latency percentile like p95, or empty for the gateway default.
+func Hedgeable(fn interface{}, delay string) server.HandlerOption {
+	if fn == nil {
+		return nilHandlerOption
+	}
+
+	delay = strings.TrimSpace(delay)
+	if delay == "" {
+		delay = "true"
+	}
+
+	return withMetadata(fn, map[string]string{APIHedgeMetadataKey: delay})
+}
+
+// Coalesced lets the gateway share one backend call between the concurrent
+// calls to the api of fn with identical parameters, use it for read apis only
+func Coalesced(fn interface{}) server.HandlerOption {
+	if fn == nil {
+		return nilHandlerOption
+	}
+
+	return withMetadata(fn, map[string]string{APICoalesceMetadataKey: "true"})
+}
+
+// Cacheable lets the gateway cache the successful results of the api of fn
+// for ttl. keys are content:<field>, header:<name> or metadata:<key> forming
+// the cache key, the whole content is the key when keys is empty.
+func Cacheable(fn interface{}, ttl time.Duration, keys ...string) server.HandlerOption {
+	if fn == nil || ttl <= 0 {
+		return nilHandlerOption
+	}
+
+	return withMetadata(fn, map[string]string{
+		APICacheTTLMetadataKey:  ttl.String(),
+		APICacheKeysMetadataKey: strings.Join(keys, ","),
+	})
+}
+
+// withMetadata merges metadata into the endpoint metadata of fn, so the
+// handler options of one handler could be combined
+func withMetadata(fn interface{}, metadata map[string]string) server.HandlerOption {
+	name, err := FuncName(fn)
+	if err != nil {
+		return nilHandlerOption
+	}
+
+	return func(o *server.HandlerOptions) {
+		endpointMetadata, exist := o.Metadata[name]
+		if !exist {
+			endpointMetadata = make(map[string]string)
+			o.Metadata[name] = endpointMetadata
+		}
+
+		for key, value := range metadata {
+			endpointMetadata[key] = value
+		}
+	}
 }
 
 func FuncName(v interface{}) (name string, err error) {
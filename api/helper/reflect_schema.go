@@ -0,0 +1,239 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/server"
+)
+
+const (
+	APIResponseSchemaMetadataKey = "post_api_response_schema"
+
+	schemaDraft = "http://json-schema.org/draft-04/schema#"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	numberType     = reflect.TypeOf(json.Number(""))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// ReflectSchema returns the json schema of the json encoding of v's type.
+// Only the fields tagged schema:"required" are required, the values which
+// could be nil also allow null. time.Time is a date-time string
+// and time.Duration an integer of nanoseconds.
+func ReflectSchema(v interface{}) *JSONSchema {
+	schema := reflectSchema(reflect.TypeOf(v), map[reflect.Type]bool{})
+	schema.Schema = schemaDraft
+	return schema
+}
+
+func reflectSchema(t reflect.Type, visiting map[reflect.Type]bool) *JSONSchema {
+	if t == nil {
+		return &JSONSchema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &JSONSchema{Type: SchemaType{"string"}, Format: "date-time"}
+	case durationType:
+		return &JSONSchema{Type: SchemaType{"integer"}}
+	case numberType:
+		return &JSONSchema{Type: SchemaType{"number"}}
+	case rawMessageType:
+		return &JSONSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: SchemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: SchemaType{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: SchemaType{"number"}}
+	case reflect.String:
+		return &JSONSchema{Type: SchemaType{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as a base64 string, [N]byte as an array
+			return &JSONSchema{Type: SchemaType{"string"}}
+		}
+
+		schema := &JSONSchema{Type: SchemaType{"array"}, Items: nullable(t.Elem(), reflectSchema(t.Elem(), visiting))}
+
+		if t.Kind() == reflect.Array {
+			// arrays are encoded with all their items
+			length := t.Len()
+			schema.MinItems, schema.MaxItems = &length, &length
+		}
+
+		return schema
+	case reflect.Map:
+		return &JSONSchema{
+			Type:                 SchemaType{"object"},
+			AdditionalProperties: &AdditionalProperties{Allowed: true, Schema: nullable(t.Elem(), reflectSchema(t.Elem(), visiting))},
+		}
+	case reflect.Struct:
+		if visiting[t] {
+			// recursive types are not expanded again
+			return &JSONSchema{Type: SchemaType{"object"}}
+		}
+
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &JSONSchema{Type: SchemaType{"object"}, Properties: make(map[string]*JSONSchema)}
+		reflectFields(t, schema, visiting)
+
+		return schema
+	}
+
+	// interfaces could be any value
+	return &JSONSchema{}
+}
+
+func reflectFields(t reflect.Type, schema *JSONSchema, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				// the fields of embedded structs are promoted
+				reflectFields(ft, schema, visiting)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := nullable(field.Type, reflectSchema(field.Type, visiting))
+
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "string" {
+				// ,string encodes numbers and bools as strings
+				fieldSchema = &JSONSchema{Type: SchemaType{"string"}}
+			}
+		}
+
+		schema.Properties[name] = fieldSchema
+
+		if isRequired(field) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// isRequired reports whether the field is tagged schema:"required", a zero
+// value is still a valid value so fields are optional by default
+func isRequired(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("schema"), ",") {
+		if strings.TrimSpace(opt) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// isNilable reports whether the values of t could be nil, they are encoded
+// as null
+func isNilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// nullable allows null in the schema of a value of t which could be nil
+func nullable(t reflect.Type, schema *JSONSchema) *JSONSchema {
+	if !isNilable(t) || len(schema.Type) == 0 {
+		return schema
+	}
+
+	schema.Type = append(schema.Type, "null")
+
+	return schema
+}
+
+// handlerTypes returns the request and response types of a go-micro handler
+// func(ctx, req, rsp) error, as a method value or method expression
+func handlerTypes(fn interface{}) (req, rsp reflect.Type, err error) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		err = errors.New("value is not a func")
+		return
+	}
+
+	if t.NumIn() < 3 {
+		err = errors.New("handler should be func(ctx, req, rsp) error")
+		return
+	}
+
+	return t.In(t.NumIn() - 2), t.In(t.NumIn() - 1), nil
+}
+
+// ReflectedSchema publishes the json schemas reflected from the request and
+// response types of the handler fn, the gateway validates the request content
+// by the request schema
+func ReflectedSchema(fn interface{}) server.HandlerOption {
+	if fn == nil {
+		return nilHandlerOption
+	}
+
+	req, rsp, err := handlerTypes(fn)
+	if err != nil {
+		return nilHandlerOption
+	}
+
+	reqSchema := reflectSchema(req, map[reflect.Type]bool{})
+	reqSchema.Schema = schemaDraft
+
+	rspSchema := reflectSchema(rsp, map[reflect.Type]bool{})
+	rspSchema.Schema = schemaDraft
+
+	reqData, err := json.Marshal(reqSchema)
+	if err != nil {
+		return nilHandlerOption
+	}
+
+	rspData, err := json.Marshal(rspSchema)
+	if err != nil {
+		return nilHandlerOption
+	}
+
+	return withMetadata(fn, map[string]string{
+		APISchemaMetadataKey:         string(reqData),
+		APIResponseSchemaMetadataKey: string(rspData),
+	})
+}
@@ -0,0 +1,146 @@
+package helper
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaAddress struct {
+	City string `json:"city" schema:"required"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type schemaBase struct {
+	ID string `json:"id" schema:"required"`
+}
+
+type schemaNode struct {
+	Name     string        `json:"name"`
+	Children []*schemaNode `json:"children"`
+}
+
+func TestReflectSchema(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "optional by default",
+			value:    struct{ Name string }{},
+			expected: `{"type": "object", "properties": {"Name": {"type": "string"}}}`,
+		},
+		{
+			name: "required tag",
+			value: struct {
+				Name string `json:"name" schema:"required"`
+				Age  int    `json:"age,omitempty"`
+			}{},
+			expected: `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}}`,
+		},
+		{
+			name: "nested struct",
+			value: struct {
+				Address schemaAddress  `json:"address"`
+				Billing *schemaAddress `json:"billing"`
+			}{},
+			expected: `{"type": "object", "properties": {
+				"address": {"type": "object", "required": ["city"], "properties": {"city": {"type": "string"}, "zip": {"type": "string"}}},
+				"billing": {"type": ["object", "null"], "required": ["city"], "properties": {"city": {"type": "string"}, "zip": {"type": "string"}}}
+			}}`,
+		},
+		{
+			name: "slices and arrays",
+			value: struct {
+				Tags []string `json:"tags"`
+				Pair [2]int   `json:"pair"`
+				Data []byte   `json:"data"`
+				Ptrs []*int   `json:"ptrs"`
+			}{},
+			expected: `{"type": "object", "properties": {
+				"tags": {"type": ["array", "null"], "items": {"type": "string"}},
+				"pair": {"type": "array", "items": {"type": "integer"}, "minItems": 2, "maxItems": 2},
+				"data": {"type": ["string", "null"]},
+				"ptrs": {"type": ["array", "null"], "items": {"type": ["integer", "null"]}}
+			}}`,
+		},
+		{
+			name: "maps",
+			value: struct {
+				Labels map[string]string      `json:"labels"`
+				Any    map[string]interface{} `json:"any"`
+			}{},
+			expected: `{"type": "object", "properties": {
+				"labels": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+				"any": {"type": ["object", "null"], "additionalProperties": {}}
+			}}`,
+		},
+		{
+			name: "time",
+			value: struct {
+				At      time.Time     `json:"at"`
+				Timeout time.Duration `json:"timeout"`
+				Since   *time.Time    `json:"since"`
+			}{},
+			expected: `{"type": "object", "properties": {
+				"at": {"type": "string", "format": "date-time"},
+				"timeout": {"type": "integer"},
+				"since": {"type": ["string", "null"], "format": "date-time"}
+			}}`,
+		},
+		{
+			name: "string option",
+			value: struct {
+				ID    int64 `json:"id,string"`
+				Valid bool  `json:"valid,omitempty,string"`
+			}{},
+			expected: `{"type": "object", "properties": {"id": {"type": "string"}, "valid": {"type": "string"}}}`,
+		},
+		{
+			name: "embedded struct",
+			value: struct {
+				schemaBase
+				Name   string `json:"name"`
+				hidden string
+				Skip   string `json:"-"`
+			}{},
+			expected: `{"type": "object", "required": ["id"], "properties": {"id": {"type": "string"}, "name": {"type": "string"}}}`,
+		},
+		{
+			name:  "recursive type",
+			value: schemaNode{},
+			expected: `{"type": "object", "properties": {
+				"name": {"type": "string"},
+				"children": {"type": ["array", "null"], "items": {"type": ["object", "null"]}}
+			}}`,
+		},
+	}
+
+	for _, c := range cases {
+		schema := ReflectSchema(c.value)
+		if schema.Schema != schemaDraft {
+			t.Errorf("%s: expected $schema %q, got %q", c.name, schemaDraft, schema.Schema)
+		}
+		schema.Schema = ""
+
+		data, err := json.Marshal(schema)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		var got, expected interface{}
+		if err = json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		if err = json.Unmarshal([]byte(c.expected), &expected); err != nil {
+			t.Fatalf("%s: bad expected schema: %s", c.name, err)
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, data)
+		}
+	}
+}
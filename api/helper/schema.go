@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"encoding/json"
+
+	"github.com/micro/go-micro/server"
+)
+
+const (
+	APISchemaMetadataKey = "post_api_schema"
+)
+
+// SchemaType is the type keyword of a schema, a single type or a list of types
+type SchemaType []string
+
+func (p SchemaType) MarshalJSON() ([]byte, error) {
+	if len(p) == 1 {
+		return json.Marshal(p[0])
+	}
+	return json.Marshal([]string(p))
+}
+
+func (p *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = SchemaType{single}
+		return nil
+	}
+
+	var types []string
+	if err := json.Unmarshal(data, &types); err != nil {
+		return err
+	}
+
+	*p = SchemaType(types)
+
+	return nil
+}
+
+// AdditionalProperties is the additionalProperties keyword, false disallows
+// the properties not listed and a schema validates their values
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *JSONSchema
+}
+
+func (p AdditionalProperties) MarshalJSON() ([]byte, error) {
+	if p.Schema != nil {
+		return json.Marshal(p.Schema)
+	}
+	return json.Marshal(p.Allowed)
+}
+
+func (p *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		*p = AdditionalProperties{Allowed: allowed}
+		return nil
+	}
+
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return err
+	}
+
+	*p = AdditionalProperties{Allowed: true, Schema: &schema}
+
+	return nil
+}
+
+// JSONSchema is the subset of JSON Schema validated by the gateway
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type                 SchemaType             `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *AdditionalProperties  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	MinItems  *int     `json:"minItems,omitempty"`
+	MaxItems  *int     `json:"maxItems,omitempty"`
+}
+
+// ParseSchema parses a json schema
+func ParseSchema(data string) (schema *JSONSchema, err error) {
+	var s JSONSchema
+	if err = json.Unmarshal([]byte(data), &s); err != nil {
+		return
+	}
+
+	schema = &s
+
+	return
+}
+
+// Schema publishes the json schema of the request content of the api of fn,
+// the gateway rejects the calls not matching it. Invalid schemas are ignored.
+func Schema(fn interface{}, schema string) server.HandlerOption {
+	if fn == nil {
+		return nilHandlerOption
+	}
+
+	if _, err := ParseSchema(schema); err != nil {
+		return nilHandlerOption
+	}
+
+	return withMetadata(fn, map[string]string{APISchemaMetadataKey: schema})
+}
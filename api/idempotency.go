@@ -0,0 +1,178 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/labstack/echo"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+	// IdempotencyKeyField is the content field carrying the idempotency key
+	// of an entry in multi-calls, it is removed before calling the backend
+	IdempotencyKeyField = "_idempotency_key"
+
+	DefaultIdempotencyWindow = time.Hour * 24
+	DefaultIdempotencySize   = 10000
+)
+
+// IdempotencyEntry is the first response of an idempotency key, ContentHash
+// detects a key reused for a different call
+type IdempotencyEntry struct {
+	ContentHash string          `json:"content_hash"`
+	Response    PostAPIResponse `json:"response"`
+}
+
+// IdempotencyStore keeps the responses of the calls with idempotency keys,
+// the default is an in-memory LRU of DefaultIdempotencySize entries
+type IdempotencyStore interface {
+	Get(key string) (entry IdempotencyEntry, exist bool)
+	Set(key string, entry IdempotencyEntry, window time.Duration)
+}
+
+type memoryIdempotencyStore struct {
+	cache Cache
+}
+
+// NewMemoryIdempotencyStore returns an in-memory store keeping at most size
+// entries
+func NewMemoryIdempotencyStore(size int) IdempotencyStore {
+	if size <= 0 {
+		size = DefaultIdempotencySize
+	}
+
+	return &memoryIdempotencyStore{cache: NewLRUCache(size)}
+}
+
+func (p *memoryIdempotencyStore) Get(key string) (entry IdempotencyEntry, exist bool) {
+	v, exist := p.cache.Get(CacheKey{Values: key})
+	if !exist {
+		return
+	}
+
+	entry, exist = v.(IdempotencyEntry)
+
+	return
+}
+
+func (p *memoryIdempotencyStore) Set(key string, entry IdempotencyEntry, window time.Duration) {
+	p.cache.Set(CacheKey{Values: key}, entry, window)
+}
+
+// idempotencyKey returns the key of a sub-call and the content without the
+// key field. Single calls use the Idempotency-Key header, entries of
+// multi-calls use their _idempotency_key field or the header joined with the
+// entry name.
+func idempotencyKey(c echo.Context, req PostAPIRequest, multiCall bool) (key string, content map[string]interface{}) {
+	content = req.Content
+	header := strings.TrimSpace(c.Request().Header().Get(IdempotencyKeyHeader))
+
+	if !multiCall {
+		return header, content
+	}
+
+	if v, exist := req.Content[IdempotencyKeyField]; exist {
+		content = make(map[string]interface{}, len(req.Content))
+		for field, value := range req.Content {
+			if field != IdempotencyKeyField {
+				content[field] = value
+			}
+		}
+
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s), content
+		}
+	}
+
+	if header == "" {
+		return
+	}
+
+	entry := req.API
+	if req.IsSpecificVersion {
+		entry += ":" + req.Version
+	}
+
+	return header + "#" + entry, content
+}
+
+// isReplayable reports whether the response could be replayed for the
+// duplicates, only successes and errors of the backends are kept. The errors
+// of the gateway, like timeouts, maintenance, unknown apis or schema
+// violations, are not kept so the client could retry them.
+func isReplayable(resp PostAPIResponse) bool {
+	return resp.Code == 0 || resp.ErrNamespace != ErrNamespace
+}
+
+// idempotencyScope scopes the idempotency keys by the client id header, so
+// one client could not replay the responses of another client using the same
+// key. The client ip is not used as it changes when a mobile client
+// reconnects, the keys of the calls without the header are scoped by
+// themselves.
+func (p *PostAPI) idempotencyScope(c echo.Context) string {
+	if p.Options.ClientIDHeader == "" {
+		return ""
+	}
+
+	return strings.TrimSpace(c.Request().Header().Get(p.Options.ClientIDHeader))
+}
+
+// idempotentCall replays the first response of the idempotency key of the
+// sub-call, the duplicates arriving while the first call is in flight wait
+// for it
+func (p *PostAPI) idempotentCall(c echo.Context, req PostAPIRequest, multiCall bool, fn func(req PostAPIRequest) PostAPIResponse) PostAPIResponse {
+	key, content := idempotencyKey(c, req, multiCall)
+	req.Content = content
+
+	if key == "" || p.Options.IdempotencyStore == nil {
+		return fn(req)
+	}
+
+	data, _ := json.Marshal(content)
+	sum := sha1.Sum(data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	storeKey := p.idempotencyScope(c) + "|" + req.API + ":" + req.Version + "|" + key
+
+	resp, shared := p.idempotencyGroup.do(storeKey+"|"+contentHash, func() PostAPIResponse {
+		if entry, exist := p.Options.IdempotencyStore.Get(storeKey); exist {
+			if entry.ContentHash != contentHash {
+				return newErrorResponse(ErrIdempotencyKeyReused.New(errors.Params{"key": key}))
+			}
+
+			p.metrics.Add("idempotency_replays", 1)
+
+			resp := entry.Response
+			resp.Replayed = true
+
+			return resp
+		}
+
+		resp := fn(req)
+
+		if isReplayable(resp) {
+			window := p.Options.IdempotencyWindow
+			if window <= 0 {
+				window = DefaultIdempotencyWindow
+			}
+
+			p.Options.IdempotencyStore.Set(storeKey, IdempotencyEntry{ContentHash: contentHash, Response: resp}, window)
+		}
+
+		return resp
+	})
+
+	if shared {
+		p.metrics.Add("idempotency_replays", 1)
+		resp.Replayed = true
+	}
+
+	return resp
+}
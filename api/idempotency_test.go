@@ -0,0 +1,100 @@
+package api_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/gogap-micro/post-api/api"
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/gogap-micro/post-api/apitest"
+	"github.com/gogap-micro/post-api/client"
+)
+
+type counterRequest struct {
+	Name string `json:"name"`
+}
+
+type counterResponse struct {
+	Calls int64 `json:"calls"`
+}
+
+type Counter struct {
+	calls int64
+}
+
+func (p *Counter) Count(ctx context.Context, req *counterRequest, rsp *counterResponse) error {
+	rsp.Calls = atomic.AddInt64(&p.calls, 1)
+	return nil
+}
+
+func newCounterKit(t *testing.T) (*apitest.Kit, *Counter) {
+	kit, err := apitest.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Counter{}
+	if err = kit.Handle("counter.v1", h, helper.ToHandlerOption(h.Count, "v1", "counter.count")); err != nil {
+		kit.Close()
+		t.Fatal(err)
+	}
+
+	return kit, h
+}
+
+func TestIdempotencyReplaysSuccess(t *testing.T) {
+	kit, h := newCounterKit(t)
+	defer kit.Close()
+
+	c := kit.Client(client.Header(api.IdempotencyKeyHeader, "key-1"))
+
+	for i := 0; i < 2; i++ {
+		var rsp counterResponse
+		if err := c.Call("counter.count", counterRequest{Name: "a"}, &rsp); err != nil {
+			t.Fatal(err)
+		}
+
+		if rsp.Calls != 1 {
+			t.Errorf("call %d: calls = %d, want the first response replayed", i, rsp.Calls)
+		}
+	}
+
+	if calls := atomic.LoadInt64(&h.calls); calls != 1 {
+		t.Errorf("backend called %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyRetriesMaintenance(t *testing.T) {
+	kit, h := newCounterKit(t)
+	defer kit.Close()
+
+	if _, err := kit.PostAPI.EnableMaintenance(api.MaintenanceSwitch{API: "counter.count", RetryAfter: "1s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := kit.Client(client.Header(api.IdempotencyKeyHeader, "key-1"))
+
+	resp, err := c.CallResponse("counter.count", counterRequest{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Code != 503 || resp.ErrNamespace != api.ErrNamespace {
+		t.Fatalf("under maintenance: error = %s:%d, want %s:503", resp.ErrNamespace, resp.Code, api.ErrNamespace)
+	}
+
+	if _, err = kit.PostAPI.DisableMaintenance("counter.count", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var rsp counterResponse
+	if err = c.Call("counter.count", counterRequest{Name: "a"}, &rsp); err != nil {
+		t.Fatalf("retry after maintenance: %s", err)
+	}
+
+	if calls := atomic.LoadInt64(&h.calls); calls != 1 {
+		t.Errorf("backend called %d times, want the retry to reach it", calls)
+	}
+}
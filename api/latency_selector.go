@@ -0,0 +1,298 @@
+package api
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	microErrors "github.com/micro/go-micro/errors"
+	"github.com/micro/go-micro/registry"
+	"github.com/micro/go-micro/selector"
+)
+
+const (
+	LatencyStrategy = "latency"
+
+	// calls not marked in time are dropped from the in-flight calls
+	latencyMarkTimeout = time.Minute
+)
+
+type LatencySelectorOptions struct {
+	// Alpha is the weight of the latest latency in the EWMA, 0 < Alpha <= 1
+	Alpha float64
+	// EjectErrors is the count of consecutive transport errors ejecting a node
+	EjectErrors int
+	// EjectDuration is how long an ejected node is skipped
+	EjectDuration time.Duration
+}
+
+var DefaultLatencySelectorOptions = LatencySelectorOptions{
+	Alpha:         0.3,
+	EjectErrors:   5,
+	EjectDuration: time.Second * 30,
+}
+
+type nodeStats struct {
+	ewma         float64
+	inflight     int
+	errors       int
+	ejectedUntil time.Time
+}
+
+// score is the expected latency of a new call, a node never called scores 0
+// so it gets its first calls soon
+func (p *nodeStats) score() float64 {
+	return p.ewma * float64(p.inflight+1)
+}
+
+// selectedCall is a call in flight between Select and Mark
+type selectedCall struct {
+	service string
+	id      string
+	start   time.Time
+}
+
+// latencySelector picks nodes by power of two choices on the EWMA latency and
+// in-flight calls tracked between Select and Mark, nodes with consecutive
+// transport errors are ejected for a while
+type latencySelector struct {
+	opts   selector.Options
+	config LatencySelectorOptions
+
+	locker sync.Mutex
+	// stats of the nodes by service and node id
+	stats map[string]map[string]*nodeStats
+	// every pick returns a copy of the node, the client marks the call with
+	// the same copy so its own start is found
+	calls map[*registry.Node]selectedCall
+}
+
+// NewLatencySelector returns a selector preferring fast nodes, use it with
+// MicroSelector or set selector.strategy to latency in the config
+func NewLatencySelector(config LatencySelectorOptions, opts ...selector.Option) selector.Selector {
+	if config.Alpha <= 0 || config.Alpha > 1 {
+		config.Alpha = DefaultLatencySelectorOptions.Alpha
+	}
+
+	if config.EjectErrors <= 0 {
+		config.EjectErrors = DefaultLatencySelectorOptions.EjectErrors
+	}
+
+	if config.EjectDuration <= 0 {
+		config.EjectDuration = DefaultLatencySelectorOptions.EjectDuration
+	}
+
+	s := &latencySelector{
+		config: config,
+		stats:  make(map[string]map[string]*nodeStats),
+		calls:  make(map[*registry.Node]selectedCall),
+	}
+
+	for _, o := range opts {
+		o(&s.opts)
+	}
+
+	if s.opts.Registry == nil {
+		s.opts.Registry = registry.DefaultRegistry
+	}
+
+	return s
+}
+
+func (p *latencySelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&p.opts)
+	}
+	return nil
+}
+
+func (p *latencySelector) Options() selector.Options {
+	return p.opts
+}
+
+func (p *latencySelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	var sopts selector.SelectOptions
+	for _, o := range opts {
+		o(&sopts)
+	}
+
+	services, err := p.opts.Registry.GetService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	p.prune(service, services)
+
+	for _, filter := range sopts.Filters {
+		services = filter(services)
+	}
+
+	var nodes []*registry.Node
+	for _, srv := range services {
+		nodes = append(nodes, srv.Nodes...)
+	}
+
+	if len(nodes) == 0 {
+		return nil, selector.ErrNoneAvailable
+	}
+
+	return func() (*registry.Node, error) {
+		return p.pick(service, nodes), nil
+	}, nil
+}
+
+// prune drops the stats of the nodes of service which left the registry
+func (p *latencySelector) prune(service string, services []*registry.Service) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	stats := p.stats[service]
+	if len(stats) == 0 {
+		return
+	}
+
+	registered := make(map[string]bool)
+	for _, srv := range services {
+		for _, node := range srv.Nodes {
+			registered[node.Id] = true
+		}
+	}
+
+	for id := range stats {
+		if !registered[id] {
+			delete(stats, id)
+		}
+	}
+}
+
+func (p *latencySelector) pick(service string, nodes []*registry.Node) *registry.Node {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now()
+
+	candidates := make([]*registry.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if stats, exist := p.stats[service][node.Id]; !exist || !now.Before(stats.ejectedUntil) {
+			candidates = append(candidates, node)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// all nodes are ejected, a call to any of them is better than none
+		candidates = nodes
+	}
+
+	node := candidates[rand.Intn(len(candidates))]
+
+	if len(candidates) > 1 {
+		i := rand.Intn(len(candidates) - 1)
+		if candidates[i] == node {
+			i = len(candidates) - 1
+		}
+
+		if other := candidates[i]; p.nodeStats(service, other.Id).score() < p.nodeStats(service, node.Id).score() {
+			node = other
+		}
+	}
+
+	p.expireCalls(now)
+
+	p.nodeStats(service, node.Id).inflight++
+
+	selected := *node
+	p.calls[&selected] = selectedCall{service: service, id: node.Id, start: now}
+
+	return &selected
+}
+
+// expireCalls drops the calls not marked in time, it should be called with
+// locker held
+func (p *latencySelector) expireCalls(now time.Time) {
+	for node, call := range p.calls {
+		if now.Sub(call.start) <= latencyMarkTimeout {
+			continue
+		}
+
+		delete(p.calls, node)
+
+		if stats, exist := p.stats[call.service][call.id]; exist && stats.inflight > 0 {
+			stats.inflight--
+		}
+	}
+}
+
+// nodeStats should be called with locker held
+func (p *latencySelector) nodeStats(service, id string) *nodeStats {
+	nodes, exist := p.stats[service]
+	if !exist {
+		nodes = make(map[string]*nodeStats)
+		p.stats[service] = nodes
+	}
+
+	stats, exist := nodes[id]
+	if !exist {
+		stats = &nodeStats{}
+		nodes[id] = stats
+	}
+
+	return stats
+}
+
+// Mark ends the call to node, only the errors of the client and the transport
+// (like connection refused or timeout) count for the ejection, an error
+// answered by the service means the node is up
+func (p *latencySelector) Mark(service string, node *registry.Node, err error) {
+	if node == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	call, exist := p.calls[node]
+	if !exist {
+		// the call expired or the node was not picked by this selector
+		return
+	}
+
+	delete(p.calls, node)
+
+	stats := p.nodeStats(call.service, call.id)
+
+	latency := float64(time.Since(call.start))
+	if stats.ewma == 0 {
+		stats.ewma = latency
+	} else {
+		stats.ewma = p.config.Alpha*latency + (1-p.config.Alpha)*stats.ewma
+	}
+
+	if stats.inflight > 0 {
+		stats.inflight--
+	}
+
+	if _, transport := err.(*microErrors.Error); !transport {
+		stats.errors = 0
+		return
+	}
+
+	if stats.errors++; stats.errors >= p.config.EjectErrors {
+		stats.errors = 0
+		stats.ejectedUntil = time.Now().Add(p.config.EjectDuration)
+	}
+}
+
+func (p *latencySelector) Reset(service string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	delete(p.stats, service)
+}
+
+func (p *latencySelector) Close() error {
+	return nil
+}
+
+func (p *latencySelector) String() string {
+	return LatencyStrategy
+}
@@ -13,6 +13,14 @@ type logrusLoggerWrapper struct {
 	l *logrus.Logger
 }
 
+func (p *PostAPI) logger() *logrus.Logger {
+	if p.Options.Logger == nil {
+		return logrus.StandardLogger()
+	}
+
+	return p.Options.Logger
+}
+
 func wrapperLogger(logger *logrus.Logger) log.Logger {
 	if logger == nil {
 		logger = logrus.StandardLogger()
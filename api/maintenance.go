@@ -0,0 +1,341 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/labstack/echo"
+)
+
+// MaintenanceSwitch disables the calls of an api (all versions when Version
+// is empty) or of every api served by Service. The disabled calls are
+// answered by ErrAPIMaintenance with Message appended and RetryAfter as the
+// retry hint. APIs are the apis routed to Service when the switch was turned
+// on, they stay disabled after the routes of the service are gone.
+type MaintenanceSwitch struct {
+	API        string    `json:"api,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Service    string    `json:"service,omitempty"`
+	APIs       []string  `json:"apis,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	RetryAfter string    `json:"retry_after,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Maintenance is the content of Options.MaintenanceFile
+type Maintenance struct {
+	Switches []MaintenanceSwitch `json:"switches"`
+}
+
+func (p *MaintenanceSwitch) Validate() (errs []error) {
+	if (strings.TrimSpace(p.API) == "") == (strings.TrimSpace(p.Service) == "") {
+		errs = append(errs, fmt.Errorf("one of api or service should be set"))
+	}
+
+	if p.Service != "" && p.Version != "" {
+		errs = append(errs, fmt.Errorf("version could not be set with service"))
+	}
+
+	if d, err := parseDuration("retry_after", p.RetryAfter); err != nil {
+		errs = append(errs, err)
+	} else if d < 0 {
+		errs = append(errs, fmt.Errorf("retry_after %s should not be negative", p.RetryAfter))
+	}
+
+	return
+}
+
+func (p *MaintenanceSwitch) key() string {
+	if p.Service != "" {
+		return "service:" + p.Service
+	}
+	return "api:" + splitKey(p.API, p.Version)
+}
+
+// target names the disabled api, version or service in the error message
+func (p *MaintenanceSwitch) target() string {
+	if p.Service != "" {
+		return "service " + p.Service
+	}
+
+	if p.Version != "" {
+		return "api " + p.API + ":" + p.Version
+	}
+
+	return "api " + p.API
+}
+
+func LoadMaintenance(filename string) (maintenance *Maintenance, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	var m Maintenance
+	if err = json.Unmarshal(data, &m); err != nil {
+		err = fmt.Errorf("parse maintenance file %s failed: %s", filename, err)
+		return
+	}
+
+	maintenance = &m
+
+	return
+}
+
+// loadMaintenance restores the switches of Options.MaintenanceFile, a
+// missing file has no switches
+func (p *PostAPI) loadMaintenance() (err error) {
+	if p.Options.MaintenanceFile == "" {
+		return
+	}
+
+	var maintenance *Maintenance
+	if maintenance, err = LoadMaintenance(p.Options.MaintenanceFile); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	switches := make(map[string]*MaintenanceSwitch)
+	for i := range maintenance.Switches {
+		s := maintenance.Switches[i]
+
+		if errs := s.Validate(); len(errs) > 0 {
+			err = fmt.Errorf("invalid maintenance file %s: switches[%d]: %s", p.Options.MaintenanceFile, i, errs[0])
+			return
+		}
+
+		switches[s.key()] = &s
+	}
+
+	p.maintenanceLocker.Lock()
+	p.maintenance = switches
+	p.maintenanceLocker.Unlock()
+
+	return
+}
+
+// saveMaintenance should be called with maintenanceLocker held
+func (p *PostAPI) saveMaintenance() (err error) {
+	if p.Options.MaintenanceFile == "" {
+		return
+	}
+
+	var data []byte
+	if data, err = json.MarshalIndent(Maintenance{Switches: p.maintenanceSwitches()}, "", "    "); err != nil {
+		return
+	}
+
+	return writeFile(p.Options.MaintenanceFile, data)
+}
+
+// maintenanceSwitches should be called with maintenanceLocker held
+func (p *PostAPI) maintenanceSwitches() []MaintenanceSwitch {
+	keys := make([]string, 0, len(p.maintenance))
+	for key := range p.maintenance {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	switches := make([]MaintenanceSwitch, 0, len(keys))
+	for _, key := range keys {
+		switches = append(switches, *p.maintenance[key])
+	}
+
+	return switches
+}
+
+// MaintenanceSwitches returns the switches turned on
+func (p *PostAPI) MaintenanceSwitches() []MaintenanceSwitch {
+	p.maintenanceLocker.Lock()
+	defer p.maintenanceLocker.Unlock()
+
+	return p.maintenanceSwitches()
+}
+
+// EnableMaintenance turns a switch on, it replaces the switch of the same api
+// and version or service. The switches are saved to Options.MaintenanceFile,
+// the switch is not turned on when the save fails.
+func (p *PostAPI) EnableMaintenance(s MaintenanceSwitch) (enabled MaintenanceSwitch, err error) {
+	if errs := s.Validate(); len(errs) > 0 {
+		err = errs[0]
+		return
+	}
+
+	s.API = strings.TrimSpace(s.API)
+	s.Service = strings.TrimSpace(s.Service)
+	s.APIs = nil
+	s.CreatedAt = time.Now()
+
+	if s.Service != "" {
+		s.APIs = p.serviceAPIs(s.Service)
+	}
+
+	p.maintenanceLocker.Lock()
+	defer p.maintenanceLocker.Unlock()
+
+	key := s.key()
+	old, exist := p.maintenance[key]
+
+	p.maintenance[key] = &s
+
+	if err = p.saveMaintenance(); err != nil {
+		if exist {
+			p.maintenance[key] = old
+		} else {
+			delete(p.maintenance, key)
+		}
+
+		err = fmt.Errorf("save maintenance file %s failed: %s", p.Options.MaintenanceFile, err)
+		return
+	}
+
+	p.logger().Warnf("maintenance of %s turned on", s.target())
+
+	enabled = s
+
+	return
+}
+
+// DisableMaintenance turns the switch of the api and version or of the
+// service off, exist is false when it is not on. The switch stays on when
+// saving Options.MaintenanceFile fails.
+func (p *PostAPI) DisableMaintenance(api, version, service string) (exist bool, err error) {
+	s := MaintenanceSwitch{
+		API:     strings.TrimSpace(api),
+		Version: strings.TrimSpace(version),
+		Service: strings.TrimSpace(service),
+	}
+
+	p.maintenanceLocker.Lock()
+	defer p.maintenanceLocker.Unlock()
+
+	key := s.key()
+
+	old, exist := p.maintenance[key]
+	if !exist {
+		return
+	}
+
+	delete(p.maintenance, key)
+
+	if err = p.saveMaintenance(); err != nil {
+		p.maintenance[key] = old
+
+		err = fmt.Errorf("save maintenance file %s failed: %s", p.Options.MaintenanceFile, err)
+		return
+	}
+
+	p.logger().Warnf("maintenance of %s turned off", s.target())
+
+	return
+}
+
+// maintenanceSwitch returns the switch disabling the resolved api version
+// served by service, an empty service means the api has no route and it
+// matches the switches of the services which served the api
+func (p *PostAPI) maintenanceSwitch(api, version, service string) (s *MaintenanceSwitch, exist bool) {
+	p.maintenanceLocker.Lock()
+	defer p.maintenanceLocker.Unlock()
+
+	if len(p.maintenance) == 0 {
+		return
+	}
+
+	for _, key := range []string{
+		"api:" + splitKey(api, version),
+		"api:" + splitKey(api, ""),
+	} {
+		if s, exist = p.maintenance[key]; exist {
+			return
+		}
+	}
+
+	if service != "" {
+		s, exist = p.maintenance["service:"+service]
+		return
+	}
+
+	for _, sw := range p.maintenance {
+		for _, served := range sw.APIs {
+			if served == api {
+				return sw, true
+			}
+		}
+	}
+
+	return
+}
+
+// serviceAPIs returns the apis routed to service
+func (p *PostAPI) serviceAPIs(service string) (apis []string) {
+	// the routes are sorted by api, the versions of an api are adjacent
+	for _, route := range p.Routes() {
+		if route.Service == service && (len(apis) == 0 || apis[len(apis)-1] != route.API) {
+			apis = append(apis, route.API)
+		}
+	}
+
+	return
+}
+
+func (p *MaintenanceSwitch) errorResponse() PostAPIResponse {
+	var e errors.ErrCode = ErrAPIMaintenance.New(errors.Params{"target": p.target()})
+	if p.Message != "" {
+		e = e.Append(p.Message)
+	}
+
+	resp := newErrorResponse(e)
+
+	if d, _ := parseDuration("retry_after", p.RetryAfter); d > 0 {
+		resp.RetryAfter = int64((d + time.Second - 1) / time.Second)
+	}
+
+	return resp
+}
+
+func (p *PostAPI) adminListMaintenanceHandle(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, p.MaintenanceSwitches())
+}
+
+// adminEnableMaintenanceHandle turns on the switch of the body
+func (p *PostAPI) adminEnableMaintenanceHandle(c echo.Context) (err error) {
+	var s MaintenanceSwitch
+	if err = c.Bind(&s); err != nil {
+		return c.JSON(http.StatusBadRequest, adminError{Error: err.Error()})
+	}
+
+	if errs := s.Validate(); len(errs) > 0 {
+		return c.JSON(http.StatusBadRequest, adminError{Error: errs[0].Error()})
+	}
+
+	var enabled MaintenanceSwitch
+	if enabled, err = p.EnableMaintenance(s); err != nil {
+		return c.JSON(http.StatusInternalServerError, adminError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, enabled)
+}
+
+// adminDisableMaintenanceHandle turns off the switch of the api, version and
+// service query parameters
+func (p *PostAPI) adminDisableMaintenanceHandle(c echo.Context) (err error) {
+	exist, err := p.DisableMaintenance(c.QueryParam("api"), c.QueryParam("version"), c.QueryParam("service"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, adminError{Error: err.Error()})
+	}
+
+	if !exist {
+		return c.JSON(http.StatusNotFound, adminError{Error: "maintenance switch not exist"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
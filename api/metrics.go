@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// metricsHandle writes the gateway metrics as expvar json
+func (p *PostAPI) metricsHandle(c echo.Context) (err error) {
+	c.Response().Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = c.Response().Write([]byte(p.metrics.String()))
+	return
+}
@@ -94,12 +94,10 @@ func (p *PostAPI) onRequestEvent(next echo.HandlerFunc) echo.HandlerFunc {
 		p.Options.Broker.Publish(p.Options.RequestTopic, reqMsg)
 
 		// process others
-		if next != nil && next(c) != nil {
-			if otherNextErr := next(c); otherNextErr != nil {
-				err = otherNextErr
+		if next != nil {
+			if err = next(c); err != nil {
 				return
 			}
-			return
 		}
 
 		// after request
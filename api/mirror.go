@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/micro/go-micro/broker"
+	"golang.org/x/net/context"
+)
+
+const (
+	DefaultMirrorTopic = "gogap.micro:topic:post-api:mirror"
+
+	// DefaultMirrorConcurrency is the max in-flight shadow calls, the calls
+	// mirrored beyond it are dropped
+	DefaultMirrorConcurrency = 64
+)
+
+const (
+	MirrorMatch    = "match"
+	MirrorMismatch = "mismatch"
+	MirrorError    = "error"
+)
+
+// Mirror sends a copy of the calls of an api to a shadow service method, the
+// shadow response is only compared with the response of the client. Version
+// could be empty to mirror all versions, Sample is the ratio of the calls
+// mirrored, 0 mirrors all of them. Ignore lists the fields skipped by the
+// comparison, see DiffResponses.
+type Mirror struct {
+	API     string   `json:"api"`
+	Version string   `json:"version,omitempty"`
+	Service string   `json:"service"`
+	Method  string   `json:"method"`
+	Sample  float64  `json:"sample,omitempty"`
+	Ignore  []string `json:"ignore,omitempty"`
+}
+
+func (p *Mirror) Validate() (errs []error) {
+	if strings.TrimSpace(p.API) == "" {
+		errs = append(errs, fmt.Errorf("api is empty"))
+	}
+
+	if strings.TrimSpace(p.Service) == "" || strings.TrimSpace(p.Method) == "" {
+		errs = append(errs, fmt.Errorf("service and method should be set"))
+	}
+
+	if p.Sample < 0 || p.Sample > 1 {
+		errs = append(errs, fmt.Errorf("sample %v should be between 0 and 1", p.Sample))
+	}
+
+	return
+}
+
+// MirrorEvent is published to Options.MirrorTopic for every shadow call,
+// Fields are the paths of the differing fields of a mismatch
+type MirrorEvent struct {
+	API             string    `json:"api"`
+	Version         string    `json:"version"`
+	Service         string    `json:"service"`
+	Method          string    `json:"method"`
+	Outcome         string    `json:"outcome"`
+	Fields          []string  `json:"fields,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	LatencyMS       float64   `json:"latency_ms"`
+	ShadowLatencyMS float64   `json:"shadow_latency_ms"`
+	LatencyDeltaMS  float64   `json:"latency_delta_ms"`
+	Time            time.Time `json:"time"`
+}
+
+func (p *PostAPI) getMirror(api, version string) (mirror *Mirror, exist bool) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	if mirror, exist = p.mirrors[splitKey(api, version)]; !exist {
+		mirror, exist = p.mirrors[splitKey(api, "")]
+	}
+
+	return
+}
+
+// Mirrors returns the mirrors of the route file
+func (p *PostAPI) Mirrors() (mirrors []Mirror) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	for _, mirror := range p.mirrors {
+		mirrors = append(mirrors, *mirror)
+	}
+
+	return
+}
+
+// mirrored makes the call by fn and mirrors it to the shadow of the api in
+// the background, the response of fn is returned as is
+func (p *PostAPI) mirrored(c echo.Context, ctx context.Context, api, version string, content map[string]interface{}, fn func() PostAPIResponse) PostAPIResponse {
+	mirror, exist := p.getMirror(api, version)
+	if !exist {
+		return fn()
+	}
+
+	start := time.Now()
+	resp := fn()
+	latency := time.Since(start)
+
+	if mirror.Sample > 0 && mirror.Sample < 1 && rand.Float64() >= mirror.Sample {
+		return resp
+	}
+
+	select {
+	case p.mirrorSlots <- struct{}{}:
+	default:
+		p.metrics.Add("mirror_dropped", 1)
+		return resp
+	}
+
+	timeout := p.getRequestTimeout(c.Request())
+
+	go func() {
+		defer func() { <-p.mirrorSlots }()
+
+		p.callMirror(ctx, timeout, *mirror, api, version, content, resp, latency)
+	}()
+
+	return resp
+}
+
+func (p *PostAPI) callMirror(ctx context.Context, timeout time.Duration, mirror Mirror, api, version string, content map[string]interface{}, resp PostAPIResponse, latency time.Duration) {
+	p.metrics.Add("mirror_calls", 1)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	shadow := p.callMicroService(ctx, mirror.Service, mirror.Method, content)
+	shadowLatency := time.Since(start)
+
+	event := MirrorEvent{
+		API:             api,
+		Version:         version,
+		Service:         mirror.Service,
+		Method:          mirror.Method,
+		LatencyMS:       milliseconds(latency),
+		ShadowLatencyMS: milliseconds(shadowLatency),
+		LatencyDeltaMS:  milliseconds(shadowLatency - latency),
+		Time:            time.Now(),
+	}
+
+	// errors of the gateway mean the shadow could not be called
+	if shadow.Code != 0 && shadow.ErrNamespace == ErrNamespace && (shadow.Code != resp.Code || resp.ErrNamespace != ErrNamespace) {
+		event.Outcome = MirrorError
+		event.Error = shadow.Message
+	} else if diffs := DiffResponses(resp, shadow, mirror.Ignore); len(diffs) > 0 {
+		event.Outcome = MirrorMismatch
+		for _, diff := range diffs {
+			event.Fields = append(event.Fields, diff.Path)
+		}
+	} else {
+		event.Outcome = MirrorMatch
+	}
+
+	p.countMirror(event)
+	p.publishMirror(event)
+
+	if event.Outcome == MirrorError {
+		p.logger().Warnf("mirror of %s:%s to %s.%s failed: %s", api, version, mirror.Service, mirror.Method, event.Error)
+	}
+}
+
+// countMirror counts the outcomes in mirror_matches, mirror_mismatches and
+// mirror_errors, and per api in mirror_outcomes keyed by api:version|outcome
+// with the sum of the latency deltas in mirror_latency_delta_ms
+func (p *PostAPI) countMirror(event MirrorEvent) {
+	switch event.Outcome {
+	case MirrorMatch:
+		p.metrics.Add("mirror_matches", 1)
+	case MirrorMismatch:
+		p.metrics.Add("mirror_mismatches", 1)
+	case MirrorError:
+		p.metrics.Add("mirror_errors", 1)
+	}
+
+	key := event.API + ":" + event.Version
+
+	if outcomes, ok := p.metrics.Get("mirror_outcomes").(*expvar.Map); ok {
+		outcomes.Add(key+"|"+event.Outcome, 1)
+	}
+
+	if deltas, ok := p.metrics.Get("mirror_latency_delta_ms").(*expvar.Map); ok {
+		deltas.AddFloat(key, event.LatencyDeltaMS)
+	}
+}
+
+func (p *PostAPI) publishMirror(event MirrorEvent) {
+	if p.Options.Broker == nil || p.Options.MirrorTopic == "" {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	msg := &broker.Message{
+		Header: map[string]string{"Content-Type": "application/json"},
+		Body:   body,
+	}
+
+	if err = p.Options.Broker.Publish(p.Options.MirrorTopic, msg); err != nil {
+		p.logger().Errorf("publish mirror event of %s:%s failed: %s", event.API, event.Version, err)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/micro/go-micro/registry"
+	"github.com/micro/go-micro/selector"
+)
+
+const (
+	APINodeLabelsHeader = "X-Api-Node-Labels"
+)
+
+// NodeLabels pins the calls of an api to the nodes whose registry metadata
+// has all the labels. Version could be empty to pin all versions of the api.
+type NodeLabels struct {
+	API     string            `json:"api"`
+	Version string            `json:"version,omitempty"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// nodeFilter reports whether a node could serve the call
+type nodeFilter func(node *registry.Node) bool
+
+func labelsFilter(labels map[string]string) nodeFilter {
+	return func(node *registry.Node) bool {
+		for key, value := range labels {
+			if node.Metadata[key] != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func nodeIDFilter(id string) nodeFilter {
+	return func(node *registry.Node) bool {
+		return node.Id == id
+	}
+}
+
+func matchNode(node *registry.Node, filters []nodeFilter) bool {
+	for _, filter := range filters {
+		if !filter(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorFilter converts the node filters to a selector filter, services
+// without any matched node are removed so the selector reports none available
+// instead of calling a node out of the filters
+func selectorFilter(filters []nodeFilter) selector.Filter {
+	return func(services []*registry.Service) []*registry.Service {
+		var filtered []*registry.Service
+
+		for _, srv := range services {
+			service := *srv
+			service.Nodes = nil
+
+			for _, node := range srv.Nodes {
+				if matchNode(node, filters) {
+					service.Nodes = append(service.Nodes, node)
+				}
+			}
+
+			if len(service.Nodes) > 0 {
+				filtered = append(filtered, &service)
+			}
+		}
+
+		return filtered
+	}
+}
+
+// parseNodeLabels parses labels like zone=a,env=qa
+func parseNodeLabels(str string) (labels map[string]string, err error) {
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			err = fmt.Errorf("invalid node label %q, should be key=value", pair)
+			return
+		}
+
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return
+}
+
+func parseCallers(callers []string) (nets []*net.IPNet, err error) {
+	for _, caller := range callers {
+		caller = strings.TrimSpace(caller)
+
+		if !strings.Contains(caller, "/") {
+			if ip := net.ParseIP(caller); ip != nil && ip.To4() != nil {
+				caller += "/32"
+			} else {
+				caller += "/128"
+			}
+		}
+
+		var ipNet *net.IPNet
+		if _, ipNet, err = net.ParseCIDR(caller); err != nil {
+			err = fmt.Errorf("invalid node label caller %q: %s", caller, err)
+			return
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return
+}
+
+// nodeLabels returns the labels the nodes of the call should have, the
+// labels of the route file are overridden by the X-Api-Node-Labels header of
+// the allowed callers
+func (p *PostAPI) nodeLabels(c echo.Context, api, version string) (labels map[string]string, err error) {
+	p.reglocker.RLock()
+	nl, exist := p.nodeLabelTable[splitKey(api, version)]
+	if !exist {
+		nl, exist = p.nodeLabelTable[splitKey(api, "")]
+	}
+	p.reglocker.RUnlock()
+
+	if exist {
+		labels = make(map[string]string, len(nl.Labels))
+		for key, value := range nl.Labels {
+			labels[key] = value
+		}
+	}
+
+	header := strings.TrimSpace(c.Request().Header().Get(APINodeLabelsHeader))
+	if header == "" {
+		return
+	}
+
+	if !p.isNodeLabelCaller(c) {
+		err = fmt.Errorf("caller is not allowed to use %s", APINodeLabelsHeader)
+		return
+	}
+
+	var headerLabels map[string]string
+	if headerLabels, err = parseNodeLabels(header); err != nil {
+		return
+	}
+
+	if labels == nil {
+		labels = make(map[string]string, len(headerLabels))
+	}
+
+	for key, value := range headerLabels {
+		labels[key] = value
+	}
+
+	return
+}
+
+func (p *PostAPI) isNodeLabelCaller(c echo.Context) bool {
+	ip := net.ParseIP(p.remoteIP(c))
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range p.nodeLabelCallers {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *PostAPI) remoteIP(c echo.Context) string {
+	addr := c.Request().RemoteAddress()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/micro/go-micro/broker"
@@ -17,6 +18,12 @@ import (
 const (
 	DefaultRequestTopic  = "gogap.micro:topic:post-api:request"
 	DefaultResponseTopic = "gogap.micro:topic:post-api:response"
+
+	DefaultClientIDHeader = "X-Client-Id"
+
+	// DefaultPath is the path of the apis served by the post-api command
+	// when the config has no path
+	DefaultPath = "/api"
 )
 
 var internalAllowHeaders = []string{
@@ -32,6 +39,22 @@ var internalAllowHeaders = []string{
 	APIHeader,
 	MultiCallHeader,
 	APICallTimeoutHeader,
+	DefaultClientIDHeader,
+	APINodeLabelsHeader,
+	"If-None-Match",
+	IdempotencyKeyHeader,
+}
+
+var internalExposeHeaders = []string{
+	APIResolvedVersionHeader,
+	"Deprecation",
+	"Sunset",
+	"Link",
+	APITargetHeader,
+	APICacheHeader,
+	"ETag",
+	IdempotencyReplayedHeader,
+	"Retry-After",
 }
 
 type EchoEngine int
@@ -49,12 +72,12 @@ type XDomainOptions struct {
 }
 
 type CORSOptions struct {
-	AllowOrigins     []string
-	AllowMethods     []string
-	AllowHeaders     []string
-	ExposeHeaders    []string
-	AllowCredentials bool
-	MaxAge           int
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"`
 }
 
 type Option func(*Options)
@@ -90,6 +113,35 @@ type Options struct {
 	ResponseTopic string
 	RequestTopic  string
 
+	RouteFile         string
+	RouteFileInterval time.Duration
+
+	SnapshotFile string
+
+	FixtureFile string
+
+	Record RecordOptions
+
+	MaintenanceFile string
+
+	RejectSunsetAPIs bool
+	ClientIDHeader   string
+
+	AdminPath  string
+	AdminToken string
+
+	NodeLabelCallers []string
+
+	Hedge HedgeOptions
+
+	Cache                  Cache
+	CacheInvalidationTopic string
+
+	MirrorTopic string
+
+	IdempotencyStore  IdempotencyStore
+	IdempotencyWindow time.Duration
+
 	Logger *logrus.Logger
 }
 
@@ -129,7 +181,7 @@ func CORS(cors CORSOptions) Option {
 
 		allowHeaders := distinctString(append(internalAllowHeaders, cors.AllowHeaders...))
 		allowMethods := distinctString(append(cors.AllowMethods, "POST"))
-		exposeHeaders := distinctString(cors.ExposeHeaders)
+		exposeHeaders := distinctString(append(internalExposeHeaders, cors.ExposeHeaders...))
 
 		o.CORS.AllowHeaders = allowHeaders
 		o.CORS.AllowMethods = allowMethods
@@ -157,7 +209,9 @@ func BodyLimit(size string) Option {
 	return func(o *Options) {
 		if size == "" {
 			o.BodyLimit = "2M"
+			return
 		}
+		o.BodyLimit = size
 	}
 }
 
@@ -262,6 +316,128 @@ func Topic(requestTopic, responseTopic string) Option {
 	}
 }
 
+// RouteFile loads static routes from filename and reloads them when the file
+// changes, the file is checked every interval. Routes discovered from the
+// registry take precedence over the file routes.
+func RouteFile(filename string, interval time.Duration) Option {
+	return func(o *Options) {
+		o.RouteFile = filename
+		o.RouteFileInterval = interval
+	}
+}
+
+// SnapshotFile persists the routing table and service nodes to filename, the
+// gateway serves from it in degraded mode when the registry is unreachable
+// at startup
+func SnapshotFile(filename string) Option {
+	return func(o *Options) {
+		o.SnapshotFile = filename
+	}
+}
+
+// RejectSunsetAPIs rejects calls to deprecated apis after their sunset date
+// instead of only warning the clients
+func RejectSunsetAPIs(reject bool) Option {
+	return func(o *Options) {
+		o.RejectSunsetAPIs = reject
+	}
+}
+
+// ClientIDHeader is the request header identifying the client, it's used to
+// count the calls of deprecated apis per client (by the client ip when the
+// header is absent) and to scope the idempotency keys
+func ClientIDHeader(header string) Option {
+	return func(o *Options) {
+		o.ClientIDHeader = header
+	}
+}
+
+// Admin serves the admin endpoints under path, the requests should carry the
+// token in the X-Admin-Token header, all of them are refused when token is
+// empty
+func Admin(path, token string) Option {
+	return func(o *Options) {
+		o.AdminPath = path
+		o.AdminToken = token
+	}
+}
+
+// NodeLabelCallers allows the callers with ip in the networks (CIDR or single
+// ip) to pin their calls to nodes by the X-Api-Node-Labels header
+func NodeLabelCallers(networks ...string) Option {
+	return func(o *Options) {
+		o.NodeLabelCallers = append(o.NodeLabelCallers, networks...)
+	}
+}
+
+// Hedge configures the hedged calls of the apis marked by helper.Hedgeable,
+// zero fields keep the defaults
+func Hedge(hedge HedgeOptions) Option {
+	return func(o *Options) {
+		o.Hedge = hedge
+	}
+}
+
+// ResponseCache stores the results of the cacheable apis in cache instead of
+// the default in-memory LRU
+func ResponseCache(cache Cache) Option {
+	return func(o *Options) {
+		o.Cache = cache
+	}
+}
+
+// CacheInvalidationTopic subscribes the topic of CacheInvalidation messages,
+// so services could invalidate the cached results after changes
+func CacheInvalidationTopic(topic string) Option {
+	return func(o *Options) {
+		o.CacheInvalidationTopic = topic
+	}
+}
+
+// Idempotency keeps the first response of each idempotency key in store for
+// window and replays it for the retries, nil store keeps the in-memory default
+func Idempotency(store IdempotencyStore, window time.Duration) Option {
+	return func(o *Options) {
+		if store != nil {
+			o.IdempotencyStore = store
+		}
+		o.IdempotencyWindow = window
+	}
+}
+
+// FixtureFile answers the apis with fixtures in filename instead of their
+// backends, the other apis are routed as usual. The file is reloaded when it
+// changes.
+func FixtureFile(filename string) Option {
+	return func(o *Options) {
+		o.FixtureFile = filename
+	}
+}
+
+// Record records the calls of the gateway and their responses to a file,
+// they could be replayed by the replay command
+func Record(record RecordOptions) Option {
+	return func(o *Options) {
+		o.Record = record
+	}
+}
+
+// MirrorTopic publishes the MirrorEvent of every shadow call to topic, empty
+// topic publishes nothing
+func MirrorTopic(topic string) Option {
+	return func(o *Options) {
+		o.MirrorTopic = strings.TrimSpace(topic)
+	}
+}
+
+// MaintenanceFile keeps the maintenance switches in filename, so they survive
+// restarts
+func MaintenanceFile(filename string) Option {
+	return func(o *Options) {
+		o.MaintenanceFile = filename
+	}
+}
+
 func distinctString(values []string) []string {
 	if values == nil {
 		return nil
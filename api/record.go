@@ -0,0 +1,426 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gogap/errors"
+	"github.com/labstack/echo"
+)
+
+const (
+	// Redacted replaces the values of the redacted fields in recordings
+	Redacted = "[REDACTED]"
+
+	// DefaultRecordBuffer is the count of recordings waiting to be written,
+	// the recordings beyond it are dropped
+	DefaultRecordBuffer = 1024
+)
+
+// the fields always redacted from the recordings
+var defaultRedactFields = []string{"Authorization", "Cookie", "Cookies", "Password", "Token"}
+
+// RecordOptions records the calls of the gateway to File, one json recording
+// per line. Redact lists the names of content, result and header fields whose
+// values are replaced, Sample is the ratio of http requests recorded, 0
+// records all of them. The recordings are written in the background, Buffer
+// (DefaultRecordBuffer when 0) recordings could wait for the writer. When
+// MaxSize is set the file is rotated to File.1 before it grows beyond MaxSize
+// bytes, so at most two files are kept.
+type RecordOptions struct {
+	File    string
+	Redact  []string
+	Sample  float64
+	Buffer  int
+	MaxSize int64
+}
+
+// Recording is an http request of the gateway with the api calls parsed by
+// getAPIRequests and their responses
+type Recording struct {
+	Time      time.Time         `json:"time"`
+	MultiCall bool              `json:"multi_call,omitempty"`
+	Header    map[string]string `json:"header,omitempty"`
+	Calls     []RecordedCall    `json:"calls"`
+}
+
+// RecordedCall is an api call of a recording, Service and Method are the
+// route of the resolved version when it was recorded
+type RecordedCall struct {
+	API               string                 `json:"api"`
+	Version           string                 `json:"version"`
+	IsSpecificVersion bool                   `json:"is_specific_version,omitempty"`
+	Service           string                 `json:"service,omitempty"`
+	Method            string                 `json:"method,omitempty"`
+	Content           map[string]interface{} `json:"content"`
+	Response          PostAPIResponse        `json:"response"`
+}
+
+// IsRedacted reports whether a field of the content was redacted, the call
+// could not be replayed as it was made
+func (p RecordedCall) IsRedacted() bool {
+	return hasRedacted(p.Content)
+}
+
+func hasRedacted(v interface{}) bool {
+	switch value := v.(type) {
+	case string:
+		return value == Redacted
+	case map[string]interface{}:
+		for _, field := range value {
+			if hasRedacted(field) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if hasRedacted(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func LoadRecordings(filename string) (recordings []Recording, err error) {
+	var file *os.File
+	if file, err = os.Open(filename); err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var recording Recording
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&recording); err != nil {
+			err = fmt.Errorf("parse recording %s:%d failed: %s", filename, line, err)
+			return
+		}
+
+		recordings = append(recordings, recording)
+	}
+
+	err = scanner.Err()
+
+	return
+}
+
+type recorder struct {
+	filename string
+	maxSize  int64
+	redact   map[string]bool
+	sample   float64
+	logger   *logrus.Logger
+
+	// file and size are only used by the writer goroutine
+	file *os.File
+	size int64
+
+	locker     sync.RWMutex
+	closed     bool
+	recordings chan *Recording
+	done       chan struct{}
+}
+
+func newRecorder(opts RecordOptions, logger *logrus.Logger) (r *recorder, err error) {
+	redact := make(map[string]bool)
+	for _, field := range append(defaultRedactFields, opts.Redact...) {
+		redact[strings.ToLower(strings.TrimSpace(field))] = true
+	}
+
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = DefaultRecordBuffer
+	}
+
+	rec := &recorder{
+		filename:   opts.File,
+		maxSize:    opts.MaxSize,
+		redact:     redact,
+		sample:     opts.Sample,
+		logger:     logger,
+		recordings: make(chan *Recording, buffer),
+		done:       make(chan struct{}),
+	}
+
+	if err = rec.open(); err != nil {
+		return
+	}
+
+	go rec.run()
+
+	r = rec
+
+	return
+}
+
+func (p *recorder) open() (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(p.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return
+	}
+
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return
+	}
+
+	p.file = file
+	p.size = info.Size()
+
+	return
+}
+
+func (p *recorder) sampled() bool {
+	return p.sample <= 0 || p.sample >= 1 || rand.Float64() < p.sample
+}
+
+// record queues the recording for the writer without waiting, ok is false
+// when the queue is full or the recorder is closed
+func (p *recorder) record(recording *Recording) (ok bool) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.recordings <- recording:
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes the queued recordings until the recorder is closed
+func (p *recorder) run() {
+	defer close(p.done)
+
+	for recording := range p.recordings {
+		if err := p.write(recording); err != nil {
+			p.logger.Errorf("record calls to %s failed: %s", p.filename, err)
+		}
+	}
+
+	if p.file != nil {
+		p.file.Close()
+	}
+}
+
+// write appends the recording as one line, the file is rotated first when
+// the line would take it beyond maxSize
+func (p *recorder) write(recording *Recording) (err error) {
+	var data []byte
+	if data, err = json.Marshal(recording); err != nil {
+		return
+	}
+
+	data = append(data, '\n')
+
+	if p.maxSize > 0 && p.size > 0 && p.size+int64(len(data)) > p.maxSize {
+		if err = p.rotate(); err != nil {
+			return
+		}
+	}
+
+	if p.file == nil {
+		if err = p.open(); err != nil {
+			return
+		}
+	}
+
+	n, err := p.file.Write(data)
+	p.size += int64(n)
+
+	return
+}
+
+// rotate renames the file to filename.1, replacing the previous one
+func (p *recorder) rotate() (err error) {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	if err = os.Rename(p.filename, p.filename+".1"); err != nil {
+		return
+	}
+
+	return p.open()
+}
+
+// close stops taking recordings and waits for the queued ones to be written
+func (p *recorder) close() {
+	p.locker.Lock()
+	if p.closed {
+		p.locker.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.recordings)
+	p.locker.Unlock()
+
+	<-p.done
+}
+
+// redactValue returns a copy of v with the values of the redacted fields
+// replaced at any depth, values other than decoded json are converted to it
+func (p *recorder) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil, string, bool, float64, json.Number:
+		return v
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			if p.redact[strings.ToLower(key)] {
+				redacted[key] = Redacted
+			} else {
+				redacted[key] = p.redactValue(field)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			redacted = append(redacted, p.redactValue(item))
+		}
+		return redacted
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&decoded); err != nil {
+		return nil
+	}
+
+	return p.redactValue(decoded)
+}
+
+func (p *recorder) redactContent(content map[string]interface{}) map[string]interface{} {
+	if content == nil {
+		return nil
+	}
+	return p.redactValue(content).(map[string]interface{})
+}
+
+func (p *recorder) redactHeader(header map[string]string) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for key, value := range header {
+		if p.redact[strings.ToLower(key)] {
+			value = Redacted
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// recordCalls records the calls and responses of the http request after
+// rpcHandle answered it, a request failed as a whole is recorded with its
+// error as the response of every call
+func (p *PostAPI) recordCalls(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if next != nil {
+			err = next(c)
+		}
+
+		if p.recorder == nil || !p.recorder.sampled() {
+			return
+		}
+
+		requests := APIRequestsFromContext(c)
+		if requests == nil {
+			return
+		}
+
+		responses := APIResponsesFromContext(c)
+		if responses == nil && err == nil {
+			return
+		}
+
+		var failed PostAPIResponse
+		if err != nil {
+			errCode, ok := err.(errors.ErrCode)
+			if !ok {
+				errCode = ErrInternalServerError.New().Append(err)
+			}
+			failed = newErrorResponse(errCode)
+		}
+
+		header := make(map[string]string)
+		for _, key := range p.Options.MicroHeaders {
+			if value := c.Request().Header().Get(key); value != "" {
+				header[key] = value
+			}
+		}
+
+		recording := &Recording{
+			Time:      time.Now(),
+			MultiCall: requests.IsMultiCall,
+			Header:    p.recorder.redactHeader(header),
+		}
+
+		for _, req := range requests.Requests {
+			key := req.API
+			if req.IsSpecificVersion {
+				key += ":" + req.Version
+			}
+
+			resp, exist := responses[key]
+			if !exist {
+				resp = failed
+			}
+			resp.Result = p.recorder.redactValue(resp.Result)
+
+			call := RecordedCall{
+				API:               req.API,
+				Version:           req.Version,
+				IsSpecificVersion: req.IsSpecificVersion,
+				Content:           p.recorder.redactContent(req.Content),
+				Response:          resp,
+			}
+
+			if resp.ResolvedVersion != "" {
+				if srv, _, exist := p.getService(req.API, resp.ResolvedVersion); exist {
+					call.Service, call.Method = srv.Service, srv.Method
+				}
+			}
+
+			recording.Calls = append(recording.Calls, call)
+		}
+
+		if !p.recorder.record(recording) {
+			p.metrics.Add("record_dropped", 1)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactValue(t *testing.T) {
+	r := &recorder{redact: map[string]bool{"password": true, "mobile": true}}
+
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{
+			name:     "top level",
+			value:    decodeJSON(t, `{"name": "a", "Password": "secret"}`),
+			expected: decodeJSON(t, `{"name": "a", "Password": "[REDACTED]"}`),
+		},
+		{
+			name:     "nested",
+			value:    decodeJSON(t, `{"user": {"profile": {"mobile": "123", "age": 1}}}`),
+			expected: decodeJSON(t, `{"user": {"profile": {"mobile": "[REDACTED]", "age": 1}}}`),
+		},
+		{
+			name:     "in arrays",
+			value:    decodeJSON(t, `{"users": [{"mobile": "1"}, {"name": "b"}, [{"password": "x"}]]}`),
+			expected: decodeJSON(t, `{"users": [{"mobile": "[REDACTED]"}, {"name": "b"}, [{"password": "[REDACTED]"}]]}`),
+		},
+		{
+			name:     "whole object",
+			value:    decodeJSON(t, `{"password": {"old": "a", "new": "b"}}`),
+			expected: decodeJSON(t, `{"password": "[REDACTED]"}`),
+		},
+		{
+			name: "structs",
+			value: struct {
+				Mobile string `json:"mobile"`
+				Age    int    `json:"age"`
+			}{Mobile: "123", Age: 1},
+			expected: decodeJSON(t, `{"mobile": "[REDACTED]", "age": 1}`),
+		},
+	}
+
+	for _, c := range cases {
+		if redacted := r.redactValue(c.value); !reflect.DeepEqual(redacted, c.expected) {
+			t.Errorf("%s: redacted = %v, want %v", c.name, redacted, c.expected)
+		}
+	}
+
+	value := decodeJSON(t, `{"user": {"mobile": "123"}}`)
+	r.redactValue(value)
+	if !reflect.DeepEqual(value, decodeJSON(t, `{"user": {"mobile": "123"}}`)) {
+		t.Errorf("redactValue changed its argument: %v", value)
+	}
+}
+
+func TestRecordedCallIsRedacted(t *testing.T) {
+	cases := []struct {
+		content  string
+		redacted bool
+	}{
+		{content: `{"name": "a"}`},
+		{content: `{"name": "[REDACTED]"}`, redacted: true},
+		{content: `{"user": {"items": [{"mobile": "[REDACTED]"}]}}`, redacted: true},
+		{content: `{"note": "contains [REDACTED] text"}`},
+	}
+
+	for _, c := range cases {
+		call := RecordedCall{Content: decodeJSON(t, c.content).(map[string]interface{})}
+		if redacted := call.IsRedacted(); redacted != c.redacted {
+			t.Errorf("%s: IsRedacted() = %t, want %t", c.content, redacted, c.redacted)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Difference is a field of a replayed response differing from the recorded
+// response, a missing field is nil
+type Difference struct {
+	Path     string      `json:"path"`
+	Recorded interface{} `json:"recorded"`
+	Replayed interface{} `json:"replayed"`
+}
+
+func (p Difference) String() string {
+	return fmt.Sprintf("%s: %s != %s", p.Path, marshalString(p.Recorded), marshalString(p.Replayed))
+}
+
+// DiffResponses compares the code, err_namespace, message and result of the
+// responses. The fields matching an ignore rule are skipped, a rule is a path
+// like result.items[*].updated_at where * matches any key or index, a rule
+// without dots or brackets matches the field at any depth.
+func DiffResponses(recorded, replayed PostAPIResponse, ignore []string) (diffs []Difference) {
+	rules := make([][]string, 0, len(ignore))
+	for _, rule := range ignore {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, splitPath(rule))
+		}
+	}
+
+	d := differ{rules: rules}
+	d.diff(nil, comparable(recorded), comparable(replayed))
+
+	return d.diffs
+}
+
+// comparable returns the compared fields of resp as decoded json
+func comparable(resp PostAPIResponse) interface{} {
+	data, _ := json.Marshal(map[string]interface{}{
+		"code":          resp.Code,
+		"err_namespace": resp.ErrNamespace,
+		"message":       resp.Message,
+		"result":        resp.Result,
+	})
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.Decode(&v)
+
+	return v
+}
+
+type differ struct {
+	rules [][]string
+	diffs []Difference
+}
+
+func (p *differ) diff(path []string, a, b interface{}) {
+	if p.ignored(path) {
+		return
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		if y, ok := b.(map[string]interface{}); ok {
+			keys := make(map[string]bool)
+			for key := range x {
+				keys[key] = true
+			}
+			for key := range y {
+				keys[key] = true
+			}
+
+			sorted := make([]string, 0, len(keys))
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+
+			for _, key := range sorted {
+				p.diff(append(path[:len(path):len(path)], key), x[key], y[key])
+			}
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			n := len(x)
+			if len(y) > n {
+				n = len(y)
+			}
+
+			for i := 0; i < n; i++ {
+				var xi, yi interface{}
+				if i < len(x) {
+					xi = x[i]
+				}
+				if i < len(y) {
+					yi = y[i]
+				}
+				p.diff(append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i)), xi, yi)
+			}
+			return
+		}
+	}
+
+	if !equalJSON(a, b) {
+		p.diffs = append(p.diffs, Difference{Path: joinPath(path), Recorded: a, Replayed: b})
+	}
+}
+
+func (p *differ) ignored(path []string) bool {
+	for _, rule := range p.rules {
+		if len(rule) == 1 && !strings.HasPrefix(rule[0], "[") {
+			if len(path) > 0 && path[len(path)-1] == rule[0] {
+				return true
+			}
+			continue
+		}
+
+		if len(rule) > len(path) {
+			continue
+		}
+
+		matched := true
+		for i, segment := range rule {
+			if segment != "*" && segment != "[*]" && segment != path[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitPath splits result.items[0].id into result, items, [0] and id
+func splitPath(path string) (segments []string) {
+	for _, field := range strings.Split(path, ".") {
+		for field != "" {
+			i := strings.Index(field, "[")
+			if i < 0 {
+				segments = append(segments, field)
+				break
+			}
+
+			if i > 0 {
+				segments = append(segments, field[:i])
+			}
+
+			j := strings.Index(field[i:], "]")
+			if j < 0 {
+				segments = append(segments, field[i:])
+				break
+			}
+
+			segments = append(segments, field[i:i+j+1])
+			field = field[i+j+1:]
+		}
+	}
+
+	return
+}
+
+func joinPath(segments []string) string {
+	var buf bytes.Buffer
+	for _, segment := range segments {
+		if buf.Len() > 0 && !strings.HasPrefix(segment, "[") {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(segment)
+	}
+	return buf.String()
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) interface{} {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewBufferString(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %s", data, err)
+	}
+	return v
+}
+
+func TestSplitPath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected []string
+	}{
+		{path: "result", expected: []string{"result"}},
+		{path: "result.items[0].id", expected: []string{"result", "items", "[0]", "id"}},
+		{path: "result.items[*].tags[1]", expected: []string{"result", "items", "[*]", "tags", "[1]"}},
+		{path: "result[0][1]", expected: []string{"result", "[0]", "[1]"}},
+		{path: "[*]", expected: []string{"[*]"}},
+		{path: "result.items[0", expected: []string{"result", "items", "[0"}},
+	}
+
+	for _, c := range cases {
+		segments := splitPath(c.path)
+		if !reflect.DeepEqual(segments, c.expected) {
+			t.Errorf("splitPath(%q) = %q, want %q", c.path, segments, c.expected)
+		}
+
+		if joined := joinPath(segments); joined != c.path {
+			t.Errorf("joinPath(%q) = %q, want %q", segments, joined, c.path)
+		}
+	}
+}
+
+func TestDiffResponses(t *testing.T) {
+	cases := []struct {
+		name     string
+		recorded PostAPIResponse
+		replayed PostAPIResponse
+		ignore   []string
+		expected []string
+	}{
+		{
+			name:     "equal numbers of different types",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"id": 1, "price": 1.50}`)},
+			replayed: PostAPIResponse{Result: map[string]interface{}{"id": float64(1), "price": 1.5}},
+		},
+		{
+			name:     "changed field",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"name": "a", "user": {"age": 1}}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"name": "a", "user": {"age": 2}}`)},
+			expected: []string{`result.user.age: 1 != 2`},
+		},
+		{
+			name:     "missing and added fields",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"a": 1}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"b": 2}`)},
+			expected: []string{`result.a: 1 != null`, `result.b: null != 2`},
+		},
+		{
+			name:     "error",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"a": 1}`)},
+			replayed: PostAPIResponse{Code: 500, ErrNamespace: ErrNamespace, Message: "internal server error"},
+			expected: []string{
+				`code: 0 != 500`,
+				`err_namespace: "" != "POST-API"`,
+				`message: "" != "internal server error"`,
+				`result: {"a":1} != null`,
+			},
+		},
+		{
+			name:     "array length changed",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"items": [1, 2]}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"items": [1, 2, 3]}`)},
+			expected: []string{`result.items[2]: null != 3`},
+		},
+		{
+			name:     "array length change ignored",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"items": [1, 2], "total": 2}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"items": [1], "total": 1}`)},
+			ignore:   []string{"result.items[*]"},
+			expected: []string{`result.total: 2 != 1`},
+		},
+		{
+			name:     "any index",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"items": [{"id": 1, "at": 1}, {"id": 2, "at": 2}]}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"items": [{"id": 1, "at": 3}, {"id": 3, "at": 4}]}`)},
+			ignore:   []string{"result.items[*].at"},
+			expected: []string{`result.items[1].id: 2 != 3`},
+		},
+		{
+			name:     "any key",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"users": {"a": {"at": 1}, "b": {"at": 2}}}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"users": {"a": {"at": 3}, "b": {"at": 4}}}`)},
+			ignore:   []string{"result.users.*.at"},
+		},
+		{
+			name:     "any depth",
+			recorded: PostAPIResponse{Result: decodeJSON(t, `{"updated_at": 1, "user": {"updated_at": 1, "items": [{"updated_at": 1}]}, "name": "a"}`)},
+			replayed: PostAPIResponse{Result: decodeJSON(t, `{"updated_at": 2, "user": {"updated_at": 2, "items": [{"updated_at": 2}]}, "name": "b"}`)},
+			ignore:   []string{" updated_at ", ""},
+			expected: []string{`result.name: "a" != "b"`},
+		},
+	}
+
+	for _, c := range cases {
+		var diffs []string
+		for _, diff := range DiffResponses(c.recorded, c.replayed, c.ignore) {
+			diffs = append(diffs, diff.String())
+		}
+
+		if !reflect.DeepEqual(diffs, c.expected) {
+			t.Errorf("%s: diffs = %q, want %q", c.name, diffs, c.expected)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	RouteSourceRegistry = "registry"
+	RouteSourceFile     = "file"
+)
+
+const (
+	defaultRouteFileInterval = time.Second * 5
+)
+
+// StaticRoutes declares routes for services which could not publish their apis
+// by helper.ToHandlerOption. Routes discovered from the registry take
+// precedence, a file route only serves an api and version that no registered
+// service provides.
+type StaticRoutes struct {
+	Routes     []Route        `json:"routes"`
+	Splits     []TrafficSplit `json:"splits"`
+	NodeLabels []NodeLabels   `json:"node_labels"`
+	HashKeys   []HashKey      `json:"hash_keys"`
+	Mirrors    []Mirror       `json:"mirrors"`
+}
+
+func LoadStaticRoutes(filename string) (routeFile *StaticRoutes, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	var rf StaticRoutes
+	if err = json.Unmarshal(data, &rf); err != nil {
+		err = fmt.Errorf("parse route file %s failed: %s", filename, err)
+		return
+	}
+
+	routeFile = &rf
+
+	return
+}
+
+// Validate checks the declared routes without touching the registry
+func (p *StaticRoutes) Validate() (errs []error) {
+	declared := map[string]int{}
+
+	for i, route := range p.Routes {
+		if strings.TrimSpace(route.API) == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: api is empty", i))
+		}
+
+		if strings.TrimSpace(route.Version) == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: version is empty", i))
+		}
+
+		if strings.TrimSpace(route.Service) == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: service is empty", i))
+		}
+
+		if strings.TrimSpace(route.Method) == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: method is empty", i))
+		}
+
+		key := route.API + ":" + route.Version
+		if j, exist := declared[key]; exist {
+			errs = append(errs, fmt.Errorf("routes[%d]: %s already declared by routes[%d]", i, key, j))
+			continue
+		}
+		declared[key] = i
+	}
+
+	splits := map[string]int{}
+
+	for i, split := range p.Splits {
+		for _, e := range split.Validate() {
+			errs = append(errs, fmt.Errorf("splits[%d]: %s", i, e))
+		}
+
+		key := splitKey(split.API, split.Version)
+		if j, exist := splits[key]; exist {
+			errs = append(errs, fmt.Errorf("splits[%d]: %s already declared by splits[%d]", i, key, j))
+			continue
+		}
+		splits[key] = i
+	}
+
+	nodeLabels := map[string]int{}
+
+	for i, nl := range p.NodeLabels {
+		if strings.TrimSpace(nl.API) == "" {
+			errs = append(errs, fmt.Errorf("node_labels[%d]: api is empty", i))
+		}
+
+		if len(nl.Labels) == 0 {
+			errs = append(errs, fmt.Errorf("node_labels[%d]: labels are empty", i))
+		}
+
+		key := splitKey(nl.API, nl.Version)
+		if j, exist := nodeLabels[key]; exist {
+			errs = append(errs, fmt.Errorf("node_labels[%d]: %s already declared by node_labels[%d]", i, key, j))
+			continue
+		}
+		nodeLabels[key] = i
+	}
+
+	hashKeys := map[string]int{}
+
+	for i, hk := range p.HashKeys {
+		if strings.TrimSpace(hk.API) == "" {
+			errs = append(errs, fmt.Errorf("hash_keys[%d]: api is empty", i))
+		}
+
+		if _, err := parseHashKey(hk.Key); err != nil {
+			errs = append(errs, fmt.Errorf("hash_keys[%d]: %s", i, err))
+		}
+
+		key := splitKey(hk.API, hk.Version)
+		if j, exist := hashKeys[key]; exist {
+			errs = append(errs, fmt.Errorf("hash_keys[%d]: %s already declared by hash_keys[%d]", i, key, j))
+			continue
+		}
+		hashKeys[key] = i
+	}
+
+	mirrors := map[string]int{}
+
+	for i, mirror := range p.Mirrors {
+		for _, e := range mirror.Validate() {
+			errs = append(errs, fmt.Errorf("mirrors[%d]: %s", i, e))
+		}
+
+		key := splitKey(mirror.API, mirror.Version)
+		if j, exist := mirrors[key]; exist {
+			errs = append(errs, fmt.Errorf("mirrors[%d]: %s already declared by mirrors[%d]", i, key, j))
+			continue
+		}
+		mirrors[key] = i
+	}
+
+	return
+}
+
+func (p *StaticRoutes) mirrorTable() map[string]*Mirror {
+	table := make(map[string]*Mirror)
+
+	for i := range p.Mirrors {
+		mirror := p.Mirrors[i]
+		table[splitKey(mirror.API, mirror.Version)] = &mirror
+	}
+
+	return table
+}
+
+func (p *StaticRoutes) hashKeyTable() map[string]*HashKey {
+	table := make(map[string]*HashKey)
+
+	for i := range p.HashKeys {
+		hk := p.HashKeys[i]
+		table[splitKey(hk.API, hk.Version)] = &hk
+	}
+
+	return table
+}
+
+func (p *StaticRoutes) nodeLabelTable() map[string]*NodeLabels {
+	table := make(map[string]*NodeLabels)
+
+	for i := range p.NodeLabels {
+		nl := p.NodeLabels[i]
+		table[splitKey(nl.API, nl.Version)] = &nl
+	}
+
+	return table
+}
+
+func (p *StaticRoutes) splitTable() map[string]*TrafficSplit {
+	table := make(map[string]*TrafficSplit)
+
+	for i := range p.Splits {
+		split := p.Splits[i]
+		table[splitKey(split.API, split.Version)] = &split
+	}
+
+	return table
+}
+
+func (p *StaticRoutes) table() map[string]map[string]microService {
+	table := make(map[string]map[string]microService)
+
+	for _, route := range p.Routes {
+		api := strings.TrimSpace(route.API)
+		version := strings.TrimSpace(route.Version)
+
+		srvs, exist := table[api]
+		if !exist {
+			srvs = make(map[string]microService)
+			table[api] = srvs
+		}
+
+		if _, exist := srvs[version]; !exist {
+			srvs[version] = microService{Service: strings.TrimSpace(route.Service), Method: strings.TrimSpace(route.Method), Metadata: route.Metadata}
+		}
+	}
+
+	return table
+}
+
+// ValidateRouteFileServices reports the file routes which point to services
+// that are unknown to the registry
+func (p *PostAPI) ValidateRouteFileServices() (errs []error) {
+	known := map[string]bool{}
+
+	// checkService looks up each service once, kind names what points to it
+	checkService := func(kind, name string) error {
+		exist, checked := known[name]
+		if !checked {
+			srvs, err := p.Options.Registry.GetService(name)
+			exist = err == nil && len(srvs) > 0
+			known[name] = exist
+		}
+
+		if !exist {
+			return fmt.Errorf("%s points to unknown service %s", kind, name)
+		}
+
+		return nil
+	}
+
+	for _, route := range p.staticRouteList() {
+		if err := checkService(fmt.Sprintf("route %s:%s", route.API, route.Version), route.Service); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, split := range p.Splits() {
+		for _, target := range split.Targets {
+			if target.Service == "" {
+				continue
+			}
+
+			if err := checkService(fmt.Sprintf("target %s of split %s", target.Name, splitKey(split.API, split.Version)), target.Service); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, mirror := range p.Mirrors() {
+		if err := checkService("mirror of "+splitKey(mirror.API, mirror.Version), mirror.Service); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+func (p *PostAPI) loadRouteFile() (err error) {
+	var routeFile *StaticRoutes
+	if routeFile, err = LoadStaticRoutes(p.Options.RouteFile); err != nil {
+		return
+	}
+
+	if errs := routeFile.Validate(); len(errs) > 0 {
+		err = fmt.Errorf("invalid route file %s: %s", p.Options.RouteFile, errs[0])
+		return
+	}
+
+	table := routeFile.table()
+	splits := routeFile.splitTable()
+	nodeLabels := routeFile.nodeLabelTable()
+	hashKeys := routeFile.hashKeyTable()
+	mirrors := routeFile.mirrorTable()
+
+	p.reglocker.Lock()
+	p.staticService = table
+	p.splits = splits
+	p.nodeLabelTable = nodeLabels
+	p.hashKeys = hashKeys
+	p.mirrors = mirrors
+	p.reglocker.Unlock()
+
+	for _, e := range p.ValidateRouteFileServices() {
+		p.logger().Warnf("route file %s: %s", p.Options.RouteFile, e)
+	}
+
+	return
+}
+
+func (p *PostAPI) watchRouteFile() {
+	p.watchFile("route file", p.Options.RouteFile, p.Options.RouteFileInterval, p.loadRouteFile)
+}
+
+// watchFile calls load whenever the modification time of filename changes,
+// the previous content is kept when load fails
+func (p *PostAPI) watchFile(kind, filename string, interval time.Duration, load func() error) {
+	if interval <= 0 {
+		interval = defaultRouteFileInterval
+	}
+
+	var lastModTime time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		lastModTime = fi.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(filename)
+		if err != nil {
+			p.logger().Warnf("stat %s %s failed: %s", kind, filename, err)
+			continue
+		}
+
+		if !fi.ModTime().After(lastModTime) {
+			continue
+		}
+
+		lastModTime = fi.ModTime()
+
+		if err = load(); err != nil {
+			p.logger().Errorf("reload %s failed, keep the previous one: %s", kind, err)
+			continue
+		}
+
+		p.logger().Infof("%s %s reloaded", kind, filename)
+	}
+}
+
+func (p *PostAPI) staticRouteList() (routes []Route) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	for api, srvs := range p.staticService {
+		for version, srv := range srvs {
+			routes = append(routes, Route{API: api, Version: version, Service: srv.Service, Method: srv.Method, Source: RouteSourceFile})
+		}
+	}
+
+	return
+}
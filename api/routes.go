@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/micro/go-micro/registry"
+	"golang.org/x/net/context"
+)
+
+type Route struct {
+	API     string `json:"api"`
+	Version string `json:"version"`
+	Service string `json:"service"`
+	Method  string `json:"method"`
+	Source  string `json:"source,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Routes returns a snapshot of the current routing table sorted by api and
+// version, file routes shadowed by registry routes are not included
+func (p *PostAPI) Routes() (routes []Route) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	for api, srvs := range p.apiService {
+		for version, srv := range srvs {
+			routes = append(routes, Route{API: api, Version: version, Service: srv.Service, Method: srv.Method, Source: RouteSourceRegistry, Metadata: srv.Metadata})
+		}
+	}
+
+	for api, srvs := range p.staticService {
+		for version, srv := range srvs {
+			if _, exist := p.apiService[api][version]; exist {
+				continue
+			}
+			routes = append(routes, Route{API: api, Version: version, Service: srv.Service, Method: srv.Method, Source: RouteSourceFile, Metadata: srv.Metadata})
+		}
+	}
+
+	sort.Sort(routesSorter(routes))
+
+	return
+}
+
+// SyncRoutes builds the routing table from all services currently in the
+// registry, the route file and the fixtures without watching them
+func (p *PostAPI) SyncRoutes() (err error) {
+	if err = p.initMicro(); err != nil {
+		return
+	}
+
+	if p.Options.RouteFile != "" {
+		if err = p.loadRouteFile(); err != nil {
+			return
+		}
+	}
+
+	if p.Options.FixtureFile != "" {
+		if err = p.loadFixtures(); err != nil {
+			return
+		}
+	}
+
+	return p.resyncRegistry()
+}
+
+// Call invokes an api through the same path as the http handler, it's useful
+// for debugging the routing table
+func (p *PostAPI) Call(ctx context.Context, api, version string, content map[string]interface{}) (resp PostAPIResponse, err error) {
+	if err = p.initMicro(); err != nil {
+		return
+	}
+
+	srv, resolved, exist := p.getService(api, version)
+	if !exist {
+		err = ErrBadRequest.New().Append(fmt.Sprintf("api not exist, %s:%v", api, version))
+		return
+	}
+
+	resp = p.callMicroService(ctx, srv.Service, srv.Method, content)
+	resp.api = api
+	resp.version = version
+	resp.ResolvedVersion = resolved
+
+	return
+}
+
+func (p *PostAPI) listServices() (names []string, err error) {
+	var srvs []*registry.Service
+	if srvs, err = p.Options.Registry.ListServices(); err != nil {
+		return
+	}
+
+	for _, srv := range srvs {
+		names = append(names, srv.Name)
+	}
+
+	return
+}
+
+type routesSorter []Route
+
+func (p routesSorter) Len() int      { return len(p) }
+func (p routesSorter) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p routesSorter) Less(i, j int) bool {
+	if p[i].API != p[j].API {
+		return p[i].API < p[j].API
+	}
+	return p[i].Version < p[j].Version
+}
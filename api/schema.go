@@ -0,0 +1,295 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gogap-micro/post-api/api/helper"
+)
+
+// SchemaViolation is a field of the request content not matching the schema
+// of the api, Field is a path like user.tags[0], empty for the content itself
+type SchemaViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// schemaCache keeps the parsed schemas by their source, the schemas come
+// with the endpoint metadata of every call
+type schemaCache struct {
+	locker  sync.RWMutex
+	schemas map[string]*helper.JSONSchema
+	regexps map[string]*regexp.Regexp
+}
+
+func (p *schemaCache) schema(data string) (schema *helper.JSONSchema, err error) {
+	p.locker.RLock()
+	schema, exist := p.schemas[data]
+	p.locker.RUnlock()
+
+	if exist {
+		return
+	}
+
+	if schema, err = helper.ParseSchema(data); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	p.schemas[data] = schema
+	p.locker.Unlock()
+
+	return
+}
+
+func (p *schemaCache) regexp(pattern string) (r *regexp.Regexp, err error) {
+	p.locker.RLock()
+	r, exist := p.regexps[pattern]
+	p.locker.RUnlock()
+
+	if exist {
+		return
+	}
+
+	if r, err = regexp.Compile(pattern); err != nil {
+		return
+	}
+
+	p.locker.Lock()
+	p.regexps[pattern] = r
+	p.locker.Unlock()
+
+	return
+}
+
+// validateContent validates the content of a call against the schema of the
+// api, the api has no schema when the endpoint metadata has none
+func (p *PostAPI) validateContent(metadata map[string]string, content map[string]interface{}) (violations []SchemaViolation, err error) {
+	data := metadata[helper.APISchemaMetadataKey]
+	if data == "" {
+		return
+	}
+
+	schema, err := p.schemas.schema(data)
+	if err != nil {
+		err = fmt.Errorf("invalid schema: %s", err)
+		return
+	}
+
+	var v interface{}
+	if content != nil {
+		v = content
+	}
+
+	violations = p.schemas.validate(schema, "", v, nil)
+
+	return
+}
+
+func (p *schemaCache) validate(schema *helper.JSONSchema, field string, value interface{}, violations []SchemaViolation) []SchemaViolation {
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(schema.Type) > 0 && !matchSchemaType(schema.Type, value) {
+		violate("should be %s", joinTypes(schema.Type))
+		return violations
+	}
+
+	if len(schema.Enum) > 0 {
+		matched := false
+		for _, e := range schema.Enum {
+			if equalJSON(e, value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			violate("should be one of %s", marshalString(schema.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, exist := v[name]; !exist {
+				violations = append(violations, SchemaViolation{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+
+		for name, fieldValue := range v {
+			if propSchema, exist := schema.Properties[name]; exist {
+				violations = p.validate(propSchema, joinField(field, name), fieldValue, violations)
+			} else if ap := schema.AdditionalProperties; ap != nil && ap.Schema != nil {
+				violations = p.validate(ap.Schema, joinField(field, name), fieldValue, violations)
+			} else if ap != nil && !ap.Allowed {
+				violations = append(violations, SchemaViolation{Field: joinField(field, name), Message: "is not allowed"})
+			}
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			violate("should have at least %d items", *schema.MinItems)
+		}
+
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			violate("should have at most %d items", *schema.MaxItems)
+		}
+
+		if schema.Items != nil {
+			for i, item := range v {
+				violations = p.validate(schema.Items, field+"["+strconv.Itoa(i)+"]", item, violations)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+
+		if schema.MinLength != nil && length < *schema.MinLength {
+			violate("should have at least %d characters", *schema.MinLength)
+		}
+
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			violate("should have at most %d characters", *schema.MaxLength)
+		}
+
+		if schema.Pattern != "" {
+			if r, err := p.regexp(schema.Pattern); err == nil && !r.MatchString(v) {
+				violate("should match %s", schema.Pattern)
+			}
+		}
+
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				violate("should be a RFC3339 date-time")
+			}
+		}
+	default:
+		if n, ok := toFloat(value); ok {
+			if schema.Minimum != nil && n < *schema.Minimum {
+				violate("should be >= %v", *schema.Minimum)
+			}
+
+			if schema.Maximum != nil && n > *schema.Maximum {
+				violate("should be <= %v", *schema.Maximum)
+			}
+		}
+	}
+
+	return violations
+}
+
+func matchSchemaType(types helper.SchemaType, value interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "number":
+			if _, ok := toFloat(value); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := toFloat(value); ok && n == float64(int64(n)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func toFloat(value interface{}) (n float64, ok bool) {
+	switch v := value.(type) {
+	case json.Number:
+		var err error
+		n, err = v.Float64()
+		ok = err == nil
+	case float64:
+		n, ok = v, true
+	}
+
+	return
+}
+
+// equalJSON compares the decoded json values, numbers are compared by value
+// at any depth
+func equalJSON(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for key, value := range x {
+			other, exist := y[key]
+			if !exist || !equalJSON(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func joinTypes(types helper.SchemaType) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return marshalString(types)
+}
+
+func marshalString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/gogap-micro/post-api/api/helper"
+)
+
+type violationsByField []SchemaViolation
+
+func (p violationsByField) Len() int           { return len(p) }
+func (p violationsByField) Less(i, j int) bool { return p[i].Field < p[j].Field }
+func (p violationsByField) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func TestValidateContent(t *testing.T) {
+	p := &PostAPI{schemas: schemaCache{schemas: make(map[string]*helper.JSONSchema), regexps: make(map[string]*regexp.Regexp)}}
+
+	cases := []struct {
+		name     string
+		schema   string
+		content  string
+		expected []SchemaViolation
+	}{
+		{
+			name:    "integer",
+			schema:  `{"type": "object", "properties": {"age": {"type": "integer"}}}`,
+			content: `{"age": 18}`,
+		},
+		{
+			name:     "integer with fraction",
+			schema:   `{"type": "object", "properties": {"age": {"type": "integer"}}}`,
+			content:  `{"age": 18.5}`,
+			expected: []SchemaViolation{{Field: "age", Message: "should be integer"}},
+		},
+		{
+			name:    "number",
+			schema:  `{"type": "object", "properties": {"price": {"type": "number"}}}`,
+			content: `{"price": 18.5}`,
+		},
+		{
+			name:     "number as string",
+			schema:   `{"type": "object", "properties": {"price": {"type": "number"}}}`,
+			content:  `{"price": "18.5"}`,
+			expected: []SchemaViolation{{Field: "price", Message: "should be number"}},
+		},
+		{
+			name:    "nullable",
+			schema:  `{"type": "object", "properties": {"tags": {"type": ["array", "null"]}}}`,
+			content: `{"tags": null}`,
+		},
+		{
+			name:     "not nullable",
+			schema:   `{"type": "object", "properties": {"tags": {"type": "array"}}}`,
+			content:  `{"tags": null}`,
+			expected: []SchemaViolation{{Field: "tags", Message: "should be array"}},
+		},
+		{
+			name:     "required",
+			schema:   `{"type": "object", "required": ["name", "age"], "properties": {"name": {"type": "string"}}}`,
+			content:  `{"name": "a"}`,
+			expected: []SchemaViolation{{Field: "age", Message: "is required"}},
+		},
+		{
+			name:    "enum",
+			schema:  `{"type": "object", "properties": {"level": {"enum": [1, 2, "max"]}}}`,
+			content: `{"level": 2.0}`,
+		},
+		{
+			name:     "not in enum",
+			schema:   `{"type": "object", "properties": {"level": {"enum": [1, 2, "max"]}}}`,
+			content:  `{"level": 3}`,
+			expected: []SchemaViolation{{Field: "level", Message: `should be one of [1,2,"max"]`}},
+		},
+		{
+			name:     "pattern",
+			schema:   `{"type": "object", "properties": {"mobile": {"type": "string", "pattern": "^[0-9]+$"}}}`,
+			content:  `{"mobile": "12a"}`,
+			expected: []SchemaViolation{{Field: "mobile", Message: "should match ^[0-9]+$"}},
+		},
+		{
+			name:     "additional properties not allowed",
+			schema:   `{"type": "object", "properties": {"name": {"type": "string"}}, "additionalProperties": false}`,
+			content:  `{"name": "a", "age": 1}`,
+			expected: []SchemaViolation{{Field: "age", Message: "is not allowed"}},
+		},
+		{
+			name:     "additional properties schema",
+			schema:   `{"type": "object", "additionalProperties": {"type": "string"}}`,
+			content:  `{"a": "x", "b": 1}`,
+			expected: []SchemaViolation{{Field: "b", Message: "should be string"}},
+		},
+		{
+			name: "nested paths",
+			schema: `{"type": "object", "properties": {"user": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}}
+			}}}`,
+			content: `{"user": {"tags": ["a", "", 1]}}`,
+			expected: []SchemaViolation{
+				{Field: "user.name", Message: "is required"},
+				{Field: "user.tags", Message: "should have at most 2 items"},
+				{Field: "user.tags[1]", Message: "should have at least 1 characters"},
+				{Field: "user.tags[2]", Message: "should be string"},
+			},
+		},
+		{
+			name:     "content",
+			schema:   `{"type": "object", "required": ["name"]}`,
+			content:  `null`,
+			expected: []SchemaViolation{{Field: "", Message: "should be object"}},
+		},
+	}
+
+	for _, c := range cases {
+		content, _ := decodeJSON(t, c.content).(map[string]interface{})
+
+		violations, err := p.validateContent(map[string]string{helper.APISchemaMetadataKey: c.schema}, content)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+
+		sort.Sort(violationsByField(violations))
+
+		if !reflect.DeepEqual(violations, c.expected) {
+			t.Errorf("%s: violations = %v, want %v", c.name, violations, c.expected)
+		}
+	}
+
+	if violations, err := p.validateContent(nil, map[string]interface{}{"a": 1}); err != nil || violations != nil {
+		t.Errorf("without schema: violations = %v, err = %v, want none", violations, err)
+	}
+
+	if _, err := p.validateContent(map[string]string{helper.APISchemaMetadataKey: "{"}, nil); err == nil {
+		t.Error("invalid schema: expected an error")
+	}
+}
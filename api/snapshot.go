@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/micro/go-micro/registry"
+)
+
+// Snapshot is the last known routing table and service nodes, it is written
+// to Options.SnapshotFile whenever they change and loaded when the registry
+// is unreachable at startup.
+type Snapshot struct {
+	UpdatedAt time.Time           `json:"updated_at"`
+	Routes    []Route             `json:"routes"`
+	Services  []*registry.Service `json:"services"`
+}
+
+func LoadSnapshot(filename string) (snapshot *Snapshot, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	var s Snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		err = fmt.Errorf("parse snapshot %s failed: %s", filename, err)
+		return
+	}
+
+	snapshot = &s
+
+	return
+}
+
+func (p *PostAPI) takeSnapshot() *Snapshot {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	snapshot := &Snapshot{UpdatedAt: time.Now()}
+
+	for api, srvs := range p.apiService {
+		for version, srv := range srvs {
+			snapshot.Routes = append(snapshot.Routes, Route{API: api, Version: version, Service: srv.Service, Method: srv.Method, Source: RouteSourceRegistry, Metadata: srv.Metadata})
+		}
+	}
+
+	for name, nodes := range p.serviceNodes {
+		srv := &registry.Service{Name: name}
+		for _, node := range nodes {
+			srv.Nodes = append(srv.Nodes, node)
+		}
+		snapshot.Services = append(snapshot.Services, srv)
+	}
+
+	return snapshot
+}
+
+func (p *PostAPI) writeSnapshot() (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(p.takeSnapshot(), "", "    "); err != nil {
+		return
+	}
+
+	return writeFile(p.Options.SnapshotFile, data)
+}
+
+// writeFile replaces filename with data by renaming a temp file, so readers
+// never see a partial file
+func writeFile(filename string, data []byte) (err error) {
+	// the temp file is created next to filename, a rename across
+	// file systems fails
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp"); err != nil {
+		return
+	}
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (p *PostAPI) restoreSnapshot() (err error) {
+	var snapshot *Snapshot
+	if snapshot, err = LoadSnapshot(p.Options.SnapshotFile); err != nil {
+		return
+	}
+
+	p.reglocker.Lock()
+	defer p.reglocker.Unlock()
+
+	p.apiService = make(map[string]map[string]microService)
+	p.serviceNodes = make(map[string]map[string]*registry.Node)
+
+	for _, route := range snapshot.Routes {
+		srvs, exist := p.apiService[route.API]
+		if !exist {
+			srvs = make(map[string]microService)
+			p.apiService[route.API] = srvs
+		}
+		srvs[route.Version] = microService{Service: route.Service, Method: route.Method, Metadata: route.Metadata}
+	}
+
+	for _, srv := range snapshot.Services {
+		p.addServiceNodes(srv)
+	}
+
+	p.rebuildHashRings()
+
+	atomic.StoreInt32(&p.ready, 1)
+
+	p.logger().Warnf("routing table restored from snapshot %s updated at %s", p.Options.SnapshotFile, snapshot.UpdatedAt.Format(time.RFC3339))
+
+	return
+}
+
+// snapshotChanged asks the snapshot loop to persist the routing table, it
+// never blocks the registry watcher
+func (p *PostAPI) snapshotChanged() {
+	if p.Options.SnapshotFile == "" {
+		return
+	}
+
+	select {
+	case p.snapshotChan <- struct{}{}:
+	default:
+	}
+}
+
+func (p *PostAPI) snapshotLoop() {
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-p.snapshotChan:
+		}
+
+		if p.isStale() {
+			// keep the snapshot we are serving from until the registry is back
+			continue
+		}
+
+		if err := p.writeSnapshot(); err != nil {
+			p.logger().Errorf("write snapshot %s failed: %s", p.Options.SnapshotFile, err)
+		}
+	}
+}
+
+func (p *PostAPI) isStale() bool {
+	return atomic.LoadInt32(&p.stale) == 1
+}
+
+func (p *PostAPI) setStale(stale bool) {
+	if stale {
+		atomic.StoreInt32(&p.stale, 1)
+	} else {
+		atomic.StoreInt32(&p.stale, 0)
+	}
+}
+
+// staleNode picks a node of service from the known nodes, it is used to
+// call services while the registry is unreachable
+func (p *PostAPI) staleNode(service string, filters []nodeFilter) (address string, err error) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	var nodes []*registry.Node
+	for _, node := range p.serviceNodes[service] {
+		if matchNode(node, filters) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	if len(nodes) == 0 {
+		err = fmt.Errorf("no known node of service %s", service)
+		return
+	}
+
+	address = nodeAddress(nodes[rand.Intn(len(nodes))])
+
+	return
+}
+
+func nodeAddress(node *registry.Node) string {
+	if node.Port > 0 {
+		return node.Address + ":" + strconv.Itoa(node.Port)
+	}
+	return node.Address
+}
+
+// readyHandle reports ready once the routing table is loaded from the
+// registry or from the snapshot, stale is true while serving the snapshot
+func (p *PostAPI) readyHandle(c echo.Context) (err error) {
+	ready := atomic.LoadInt32(&p.ready) == 1
+
+	status := map[string]interface{}{
+		"ready": ready,
+		"stale": p.isStale(),
+	}
+
+	if !ready {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
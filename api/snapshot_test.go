@@ -0,0 +1,50 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileRelative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "post-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"first", "second"} {
+		if err = writeFile("snapshot.json", []byte(data)); err != nil {
+			t.Fatalf("write %q: %s", data, err)
+		}
+
+		var got []byte
+		if got, err = ioutil.ReadFile(filepath.Join(dir, "snapshot.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != data {
+			t.Errorf("expected %q, got %q", data, got)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("expected only the snapshot file, got %d files", len(files))
+	}
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	APITargetHeader = "X-Api-Target"
+)
+
+// TrafficSplit routes an api to several weighted targets, a target is
+// another version of the api or a service method. Version could be empty to
+// split all versions of the api.
+type TrafficSplit struct {
+	API     string        `json:"api"`
+	Version string        `json:"version,omitempty"`
+	Targets []SplitTarget `json:"targets"`
+	Rules   []SplitRule   `json:"rules,omitempty"`
+	Sticky  string        `json:"sticky,omitempty"`
+}
+
+type SplitTarget struct {
+	Name    string `json:"name"`
+	Weight  int    `json:"weight"`
+	Version string `json:"version,omitempty"`
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+// SplitRule pins the calls with a header or cookie value to a target, the
+// rules are checked in order before the weights
+type SplitRule struct {
+	Header string `json:"header,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+	Value  string `json:"value"`
+	Target string `json:"target"`
+}
+
+func (p *TrafficSplit) Validate() (errs []error) {
+	if strings.TrimSpace(p.API) == "" {
+		errs = append(errs, fmt.Errorf("api is empty"))
+	}
+
+	if len(p.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("targets are empty"))
+	}
+
+	names := map[string]bool{}
+	total := 0
+
+	for i, target := range p.Targets {
+		if target.Name == "" {
+			errs = append(errs, fmt.Errorf("targets[%d]: name is empty", i))
+		} else if names[target.Name] {
+			errs = append(errs, fmt.Errorf("targets[%d]: name %s is duplicated", i, target.Name))
+		}
+		names[target.Name] = true
+
+		if target.Weight < 0 {
+			errs = append(errs, fmt.Errorf("targets[%d]: weight is negative", i))
+		}
+		total += target.Weight
+
+		if target.Version == "" && (target.Service == "" || target.Method == "") {
+			errs = append(errs, fmt.Errorf("targets[%d]: version or service and method should be set", i))
+		}
+	}
+
+	if len(p.Targets) > 0 && total <= 0 {
+		errs = append(errs, fmt.Errorf("total weight should be positive"))
+	}
+
+	for i, rule := range p.Rules {
+		if (rule.Header == "") == (rule.Cookie == "") {
+			errs = append(errs, fmt.Errorf("rules[%d]: one of header or cookie should be set", i))
+		}
+
+		if !names[rule.Target] {
+			errs = append(errs, fmt.Errorf("rules[%d]: unknown target %s", i, rule.Target))
+		}
+	}
+
+	if _, err := parseStickyKey(p.Sticky); err != nil {
+		errs = append(errs, err)
+	}
+
+	return
+}
+
+type stickyKey struct {
+	Source string
+	Name   string
+}
+
+// parseStickyKey parses the sticky option of a split: client, header:<name>
+// or cookie:<name>
+func parseStickyKey(sticky string) (key stickyKey, err error) {
+	sticky = strings.TrimSpace(sticky)
+
+	switch {
+	case sticky == "":
+	case sticky == "client":
+		key.Source = "client"
+	case strings.HasPrefix(sticky, "header:") && len(sticky) > len("header:"):
+		key = stickyKey{Source: "header", Name: sticky[len("header:"):]}
+	case strings.HasPrefix(sticky, "cookie:") && len(sticky) > len("cookie:"):
+		key = stickyKey{Source: "cookie", Name: sticky[len("cookie:"):]}
+	default:
+		err = fmt.Errorf("invalid sticky %q, should be client, header:<name> or cookie:<name>", sticky)
+	}
+
+	return
+}
+
+func splitKey(api, version string) string {
+	return api + ":" + version
+}
+
+// getSplit returns the split of the resolved api version with the runtime
+// weights applied
+func (p *PostAPI) getSplit(api, version string) (split TrafficSplit, exist bool) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	var s *TrafficSplit
+	if s, exist = p.splits[splitKey(api, version)]; !exist {
+		if s, exist = p.splits[splitKey(api, "")]; !exist {
+			return
+		}
+	}
+
+	split = *s
+	split.Targets = make([]SplitTarget, len(s.Targets))
+	copy(split.Targets, s.Targets)
+
+	if weights, exist := p.splitWeights[splitKey(s.API, s.Version)]; exist {
+		for i, target := range split.Targets {
+			if weight, exist := weights[target.Name]; exist {
+				split.Targets[i].Weight = weight
+			}
+		}
+	}
+
+	return
+}
+
+// pickTarget chooses the target of a split by the rules, then by weight with
+// the sticky key hashed into the weights so the same client keeps its target
+func (p *PostAPI) pickTarget(c echo.Context, split TrafficSplit) (target SplitTarget) {
+	for _, rule := range split.Rules {
+		var value string
+		if rule.Header != "" {
+			value = c.Request().Header().Get(rule.Header)
+		} else if cookie, err := c.Request().Cookie(rule.Cookie); err == nil {
+			value = cookie.Value()
+		}
+
+		if value == "" || value != rule.Value {
+			continue
+		}
+
+		for _, t := range split.Targets {
+			if t.Name == rule.Target {
+				return t
+			}
+		}
+	}
+
+	total := 0
+	for _, t := range split.Targets {
+		total += t.Weight
+	}
+
+	if total <= 0 {
+		return split.Targets[0]
+	}
+
+	var point int
+	if key := p.stickyValue(c, split.Sticky); key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		point = int(h.Sum32() % uint32(total))
+	} else {
+		point = rand.Intn(total)
+	}
+
+	for _, t := range split.Targets {
+		if point < t.Weight {
+			return t
+		}
+		point -= t.Weight
+	}
+
+	return split.Targets[len(split.Targets)-1]
+}
+
+func (p *PostAPI) stickyValue(c echo.Context, sticky string) string {
+	key, err := parseStickyKey(sticky)
+	if err != nil {
+		return ""
+	}
+
+	switch key.Source {
+	case "client":
+		return p.clientID(c)
+	case "header":
+		return c.Request().Header().Get(key.Name)
+	case "cookie":
+		if cookie, err := c.Request().Cookie(key.Name); err == nil {
+			return cookie.Value()
+		}
+	}
+
+	return ""
+}
+
+// routeSplit returns the service of the target chosen for the call, exist is
+// false when the api has no split
+func (p *PostAPI) routeSplit(c echo.Context, api, version string) (srv microService, resolved, targetName string, exist bool, err error) {
+	var split TrafficSplit
+	if split, exist = p.getSplit(api, version); !exist {
+		return
+	}
+
+	target := p.pickTarget(c, split)
+	targetName = target.Name
+
+	if target.Version == "" {
+		srv = microService{Service: target.Service, Method: target.Method}
+		resolved = version
+		return
+	}
+
+	var found bool
+	if srv, resolved, found = p.getService(api, target.Version); !found {
+		err = fmt.Errorf("target %s of api %s:%s points to unknown version %s", target.Name, api, version, target.Version)
+	}
+
+	return
+}
+
+// SetSplitWeights changes the weights of the targets of a split at runtime,
+// the weights are kept when the route file is reloaded
+func (p *PostAPI) SetSplitWeights(api, version string, weights map[string]int) (err error) {
+	p.reglocker.Lock()
+	defer p.reglocker.Unlock()
+
+	key := splitKey(api, version)
+
+	split, exist := p.splits[key]
+	if !exist {
+		err = fmt.Errorf("split of %s not exist", key)
+		return
+	}
+
+	// the weights not given keep their effective value, the one set at
+	// runtime before or the one of the route file
+	current := p.splitWeights[key]
+
+	total := 0
+	for _, target := range split.Targets {
+		weight := target.Weight
+		if w, exist := current[target.Name]; exist {
+			weight = w
+		}
+		if w, exist := weights[target.Name]; exist {
+			weight = w
+		}
+
+		if weight < 0 {
+			err = fmt.Errorf("weight of target %s is negative", target.Name)
+			return
+		}
+		total += weight
+	}
+
+	for name := range weights {
+		found := false
+		for _, target := range split.Targets {
+			found = found || target.Name == name
+		}
+
+		if !found {
+			err = fmt.Errorf("target %s of split %s not exist", name, key)
+			return
+		}
+	}
+
+	if total <= 0 {
+		err = fmt.Errorf("total weight should be positive")
+		return
+	}
+
+	if current == nil {
+		current = make(map[string]int)
+		p.splitWeights[key] = current
+	}
+
+	for name, weight := range weights {
+		current[name] = weight
+	}
+
+	return
+}
+
+// Splits returns the traffic splits with the runtime weights applied
+func (p *PostAPI) Splits() (splits []TrafficSplit) {
+	p.reglocker.RLock()
+	keys := make([][2]string, 0, len(p.splits))
+	for _, split := range p.splits {
+		keys = append(keys, [2]string{split.API, split.Version})
+	}
+	p.reglocker.RUnlock()
+
+	for _, key := range keys {
+		if split, exist := p.getSplit(key[0], key[1]); exist {
+			splits = append(splits, split)
+		}
+	}
+
+	return
+}
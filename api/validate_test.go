@@ -0,0 +1,68 @@
+package api_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/gogap-micro/post-api/client"
+)
+
+type createUserRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+type User struct {
+	calls int64
+}
+
+func (p *User) Create(ctx context.Context, req *createUserRequest, rsp *counterResponse) error {
+	rsp.Calls = atomic.AddInt64(&p.calls, 1)
+	return nil
+}
+
+func TestValidateMultiCall(t *testing.T) {
+	kit, counter := newCounterKit(t)
+	defer kit.Close()
+
+	user := &User{}
+	if err := kit.Handle("user.v1", user,
+		helper.ToHandlerOption(user.Create, "v1", "user.create"),
+		helper.Schema(user.Create, `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string", "minLength": 1}}}`),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var created, counted counterResponse
+
+	batch := client.NewBatch()
+	createCall := batch.Add("user.create", createUserRequest{}, &created)
+	countCall := batch.Add("counter.count", counterRequest{Name: "a"}, &counted)
+
+	if err := kit.Client().CallBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if createCall.Err == nil || createCall.Response.Code != 400 {
+		t.Fatalf("invalid sub-call: err = %v, want 400", createCall.Err)
+	}
+
+	violations := createCall.Response.Violations
+	if len(violations) != 1 || violations[0].Field != "name" || violations[0].Message != "is required" {
+		t.Errorf("violations = %v, want name is required", violations)
+	}
+
+	if calls := atomic.LoadInt64(&user.calls); calls != 0 {
+		t.Errorf("invalid sub-call reached the backend %d times", calls)
+	}
+
+	if countCall.Err != nil || counted.Calls != 1 {
+		t.Errorf("valid sub-call: err = %v, calls = %d, want it answered by the backend", countCall.Err, counted.Calls)
+	}
+
+	if calls := atomic.LoadInt64(&counter.calls); calls != 1 {
+		t.Errorf("backend of the valid sub-call called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LatestVersion = "latest"
+)
+
+type semVersion struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// parseSemVersion parses versions like v1.2.3, 1.2.3 and v1.2.3-beta, the
+// leading v is optional and the missing minor and patch of v1 and v1.2 are 0
+func parseSemVersion(version string) (ver semVersion, err error) {
+	str := strings.TrimSpace(version)
+
+	prerelease := ""
+	if idx := strings.IndexRune(str, '-'); idx >= 0 {
+		prerelease = str[idx+1:]
+		str = str[:idx]
+	}
+
+	if ver, _, err = parsePartialVersion(str); err != nil {
+		err = fmt.Errorf("version %q is not a semantic version", version)
+		return
+	}
+
+	ver.Prerelease = prerelease
+
+	return
+}
+
+func (p semVersion) Compare(o semVersion) int {
+	switch {
+	case p.Major != o.Major:
+		return compareInt(p.Major, o.Major)
+	case p.Minor != o.Minor:
+		return compareInt(p.Minor, o.Minor)
+	case p.Patch != o.Patch:
+		return compareInt(p.Patch, o.Patch)
+	case p.Prerelease == o.Prerelease:
+		return 0
+	case p.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	return strings.Compare(p.Prerelease, o.Prerelease)
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+type versionComparator struct {
+	Op      string
+	Version semVersion
+}
+
+func (p versionComparator) Match(ver semVersion) bool {
+	c := ver.Compare(p.Version)
+
+	switch p.Op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+
+	return c == 0
+}
+
+// versionRange is a set of comparators which should all match
+type versionRange []versionComparator
+
+func (p versionRange) Match(ver semVersion) bool {
+	if ver.Prerelease != "" {
+		// prereleases are only resolved by exact version
+		return false
+	}
+
+	for _, comparator := range p {
+		if !comparator.Match(ver) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseVersionRange parses the version a client asked for:
+//
+//	latest           the highest version
+//	v1, v1.2         the highest v1.x.y, v1.2.y
+//	^1.2.3, ^1.2     >=1.2.3 <2.0.0, >=1.2.0 <2.0.0
+//	~1.2.3, ~1.2     >=1.2.3 <1.3.0, >=1.2.0 <1.3.0
+//	>=1.2.0 <1.4.0   all comparators separated by space should match
+func parseVersionRange(expr string) (vr versionRange, err error) {
+	expr = strings.TrimSpace(expr)
+
+	if expr == LatestVersion || expr == "*" {
+		vr = versionRange{}
+		return
+	}
+
+	for _, field := range strings.Fields(expr) {
+		var comparators versionRange
+		if comparators, err = parseVersionComparators(field); err != nil {
+			return
+		}
+		vr = append(vr, comparators...)
+	}
+
+	if len(vr) == 0 {
+		err = fmt.Errorf("version range %q is empty", expr)
+	}
+
+	return
+}
+
+func parseVersionComparators(field string) (vr versionRange, err error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(field, prefix) {
+			op = prefix
+			field = field[len(prefix):]
+			break
+		}
+	}
+
+	var ver semVersion
+	var parts int
+	if ver, parts, err = parsePartialVersion(field); err != nil {
+		return
+	}
+
+	var upper semVersion
+
+	switch op {
+	case "", "=":
+		switch parts {
+		case 1:
+			upper = semVersion{Major: ver.Major + 1}
+		case 2:
+			upper = semVersion{Major: ver.Major, Minor: ver.Minor + 1}
+		default:
+			vr = versionRange{{Op: "=", Version: ver}}
+			return
+		}
+	case "^":
+		switch {
+		case ver.Major > 0 || parts == 1:
+			upper = semVersion{Major: ver.Major + 1}
+		case ver.Minor > 0 || parts == 2:
+			upper = semVersion{Minor: ver.Minor + 1}
+		default:
+			upper = semVersion{Patch: ver.Patch + 1}
+		}
+	case "~":
+		if parts == 1 {
+			upper = semVersion{Major: ver.Major + 1}
+		} else {
+			upper = semVersion{Major: ver.Major, Minor: ver.Minor + 1}
+		}
+	default:
+		vr = versionRange{{Op: op, Version: ver}}
+		return
+	}
+
+	vr = versionRange{{Op: ">=", Version: ver}, {Op: "<", Version: upper}}
+
+	return
+}
+
+// parsePartialVersion parses v1, 1.2 and 1.2.3, it returns how many parts
+// were given
+func parsePartialVersion(str string) (ver semVersion, parts int, err error) {
+	str = strings.TrimPrefix(strings.TrimSpace(str), "v")
+
+	fields := strings.Split(str, ".")
+	if str == "" || len(fields) > 3 {
+		err = fmt.Errorf("invalid version %q", str)
+		return
+	}
+
+	nums := make([]int, 3)
+	for i, field := range fields {
+		if nums[i], err = strconv.Atoi(field); err != nil || nums[i] < 0 {
+			err = fmt.Errorf("invalid version %q", str)
+			return
+		}
+	}
+
+	ver.Major, ver.Minor, ver.Patch = nums[0], nums[1], nums[2]
+	parts = len(fields)
+
+	return
+}
+
+// resolveVersion picks the version which best matches expr from versions,
+// an exact match always wins, otherwise the highest semantic version in the
+// range is used
+func resolveVersion(expr string, versions []string) (resolved string, exist bool) {
+	for _, version := range versions {
+		if version == expr {
+			return version, true
+		}
+	}
+
+	vr, err := parseVersionRange(expr)
+	if err != nil {
+		return
+	}
+
+	var best semVersion
+
+	for _, version := range versions {
+		ver, err := parseSemVersion(version)
+		if err != nil || !vr.Match(ver) {
+			continue
+		}
+
+		if !exist || ver.Compare(best) > 0 {
+			best = ver
+			resolved = version
+			exist = true
+		}
+	}
+
+	return
+}
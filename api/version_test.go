@@ -0,0 +1,86 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestParseSemVersion(t *testing.T) {
+	cases := []struct {
+		version  string
+		expected semVersion
+		invalid  bool
+	}{
+		{version: "v1.2.3", expected: semVersion{Major: 1, Minor: 2, Patch: 3}},
+		{version: "1.2.3", expected: semVersion{Major: 1, Minor: 2, Patch: 3}},
+		{version: "v1.2.3-beta", expected: semVersion{Major: 1, Minor: 2, Patch: 3, Prerelease: "beta"}},
+		{version: "v1", expected: semVersion{Major: 1}},
+		{version: "v2.1", expected: semVersion{Major: 2, Minor: 1}},
+		{version: "v2-rc1", expected: semVersion{Major: 2, Prerelease: "rc1"}},
+		{version: "", invalid: true},
+		{version: "v", invalid: true},
+		{version: "v1.2.3.4", invalid: true},
+		{version: "v1.x", invalid: true},
+		{version: "v-1", invalid: true},
+		{version: "latest", invalid: true},
+	}
+
+	for _, c := range cases {
+		ver, err := parseSemVersion(c.version)
+
+		if c.invalid {
+			if err == nil {
+				t.Errorf("parseSemVersion(%q) = %+v, want an error", c.version, ver)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseSemVersion(%q) failed: %s", c.version, err)
+			continue
+		}
+
+		if ver != c.expected {
+			t.Errorf("parseSemVersion(%q) = %+v, want %+v", c.version, ver, c.expected)
+		}
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	cases := []struct {
+		expr     string
+		versions []string
+		expected string
+	}{
+		{expr: "v1", versions: []string{"v1", "v2"}, expected: "v1"},
+		{expr: "latest", versions: []string{"v1", "v2"}, expected: "v2"},
+		{expr: "latest", versions: []string{"v1", "v1.2.0", "v2-beta"}, expected: "v1.2.0"},
+		{expr: "*", versions: []string{"v2", "v10"}, expected: "v10"},
+		{expr: "v1", versions: []string{"v1.0.0", "v1.3.1", "v2.0.0"}, expected: "v1.3.1"},
+		{expr: "v1.2", versions: []string{"v1.2.0", "v1.2.5", "v1.3.0"}, expected: "v1.2.5"},
+		{expr: "^1.2", versions: []string{"v1.1.0", "v1.4.0", "v2"}, expected: "v1.4.0"},
+		{expr: "^2", versions: []string{"v1", "v2", "v3"}, expected: "v2"},
+		{expr: "~1.2.3", versions: []string{"v1.2.4", "v1.3.0"}, expected: "v1.2.4"},
+		{expr: ">=1.2.0 <1.4.0", versions: []string{"v1.1", "v1.3", "v1.4"}, expected: "v1.3"},
+		{expr: ">=2", versions: []string{"v1", "v2", "v3"}, expected: "v3"},
+		{expr: "v2-beta", versions: []string{"v1", "v2-beta"}, expected: "v2-beta"},
+		{expr: "beta", versions: []string{"beta", "v1"}, expected: "beta"},
+		{expr: "v3", versions: []string{"v1", "v2"}},
+		{expr: "latest", versions: []string{"beta", "v2-rc1"}},
+		{expr: "not a range", versions: []string{"v1"}},
+	}
+
+	for _, c := range cases {
+		resolved, exist := resolveVersion(c.expr, c.versions)
+
+		if c.expected == "" {
+			if exist {
+				t.Errorf("resolveVersion(%q, %v) = %q, want none", c.expr, c.versions, resolved)
+			}
+			continue
+		}
+
+		if !exist || resolved != c.expected {
+			t.Errorf("resolveVersion(%q, %v) = %q, %v, want %q", c.expr, c.versions, resolved, exist, c.expected)
+		}
+	}
+}
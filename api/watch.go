@@ -1,42 +1,223 @@
 package api
 
 import (
+	"expvar"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gogap-micro/post-api/api/helper"
 	"github.com/micro/go-micro/registry"
 )
 
-func (p *PostAPI) watch(watcher registry.Watcher) error {
-	defer watcher.Stop()
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = time.Second * 30
+)
+
+const (
+	watcherConnecting   = "connecting"
+	watcherWatching     = "watching"
+	watcherReconnecting = "reconnecting"
+	watcherStopped      = "stopped"
+)
+
+// superviseWatch keeps the registry watcher running until Stop is called, a
+// broken watcher is reopened with exponential backoff and the routing table
+// is re-synced after each reconnect. The backoff is only reset once the
+// watcher delivered an event or stayed up for the max backoff, so a watcher
+// breaking right after it opens keeps backing off. When the registry is
+// unreachable at startup the routing table is restored from the snapshot,
+// without a snapshot the gateway keeps retrying and is not ready until the
+// registry is reached.
+func (p *PostAPI) superviseWatch() (err error) {
+	p.setWatcherState(watcherConnecting)
+	defer p.setWatcherState(watcherStopped)
+
+	backoff := minWatchBackoff
+	connected := false
+
+	for {
+		var watcher registry.Watcher
+		if watcher, err = p.openWatcher(); err == nil {
+			if connected {
+				p.metrics.Add("watcher_reconnects", 1)
+				p.logger().Info("registry watcher reconnected")
+			}
+
+			if p.isStale() {
+				p.setStale(false)
+				p.logger().Info("registry is back, leave degraded mode")
+			}
+
+			connected = true
+			p.setWatcherState(watcherWatching)
+
+			started := time.Now()
+
+			var events int
+			if events, err = p.watch(watcher); events > 0 || time.Since(started) >= maxWatchBackoff {
+				backoff = minWatchBackoff
+			}
+		} else if !connected && p.Options.SnapshotFile != "" {
+			if !p.isStale() {
+				if e := p.restoreSnapshot(); e != nil {
+					p.logger().Errorf("restore snapshot failed: %s", e)
+				} else {
+					p.setStale(true)
+				}
+			}
+		}
+
+		select {
+		case <-p.stopChan:
+			err = nil
+			return
+		default:
+		}
+
+		p.metrics.Add("watcher_errors", 1)
+		p.setWatcherState(watcherReconnecting)
+		p.logger().Warnf("registry watcher failed, retry in %s: %s", backoff, err)
+
+		select {
+		case <-p.stopChan:
+			err = nil
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+func (p *PostAPI) openWatcher() (watcher registry.Watcher, err error) {
+	if watcher, err = p.Options.Registry.Watch(); err != nil {
+		return
+	}
+
+	if err = p.resyncRegistry(); err != nil {
+		watcher.Stop()
+		watcher = nil
+	}
+
+	return
+}
+
+func (p *PostAPI) setWatcherState(state string) {
+	watcherState := new(expvar.String)
+	watcherState.Set(state)
+	p.metrics.Set("watcher_state", watcherState)
+}
+
+// resyncRegistry rebuilds the registry routes and service nodes from all
+// services currently in the registry
+func (p *PostAPI) resyncRegistry() (err error) {
+	var names []string
+	if names, err = p.listServices(); err != nil {
+		return
+	}
+
+	var services []*registry.Service
+
+	for _, name := range names {
+		srvs, e := p.Options.Registry.GetService(name)
+		if e != nil {
+			err = fmt.Errorf("get service %s from registry failed: %s", name, e)
+			return
+		}
+		services = append(services, srvs...)
+	}
+
+	p.reglocker.Lock()
+
+	p.apiService = make(map[string]map[string]microService)
+	p.serviceNodes = make(map[string]map[string]*registry.Node)
+
+	for _, srv := range services {
+		p.createOrUpdateMicroService(srv)
+		p.addServiceNodes(srv)
+	}
+
+	p.rebuildHashRings()
+
+	p.reglocker.Unlock()
+
+	atomic.StoreInt32(&p.ready, 1)
+
+	p.snapshotChanged()
+
+	return
+}
+
+// watch applies the watcher results to the routing table until the watcher
+// fails, it returns the count of the results applied
+func (p *PostAPI) watch(watcher registry.Watcher) (events int, err error) {
+	var stopOnce sync.Once
+	stopWatcher := func() { stopOnce.Do(watcher.Stop) }
+
+	done := make(chan struct{})
+
+	defer func() {
+		close(done)
+		stopWatcher()
+	}()
 
 	// manage this loop
 	go func() {
 		// wait for exit
 		select {
-		case <-p.stopedChan:
+		case <-p.stopChan:
+		case <-done:
+			return
 		}
 
 		// stop the watcher
-		watcher.Stop()
+		stopWatcher()
 	}()
 
 	for {
-		res, err := watcher.Next()
-		if err != nil {
-			return err
+		var res *registry.Result
+		if res, err = watcher.Next(); err != nil {
+			return
 		}
 		p.updateAPIService(res)
+		events++
 	}
 }
 
-func (p *PostAPI) getService(api, version string) (srv microService, exist bool) {
-	var srvs map[string]microService
-	if srvs, exist = p.apiService[api]; exist {
-		if srv, exist = srvs[version]; exist {
-			return
+// getService resolves the requested version of api to a registered version,
+// see resolveVersion. Registry routes take precedence over file routes with
+// the same version.
+func (p *PostAPI) getService(api, version string) (srv microService, resolved string, exist bool) {
+	p.reglocker.RLock()
+	defer p.reglocker.RUnlock()
+
+	var versions []string
+	for ver := range p.apiService[api] {
+		versions = append(versions, ver)
+	}
+
+	for ver := range p.staticService[api] {
+		if _, exist := p.apiService[api][ver]; !exist {
+			versions = append(versions, ver)
 		}
 	}
+
+	if resolved, exist = resolveVersion(version, versions); !exist {
+		return
+	}
+
+	if srv, exist = p.apiService[api][resolved]; exist {
+		return
+	}
+
+	srv, exist = p.staticService[api][resolved]
+
 	return
 }
 
@@ -51,13 +232,50 @@ func (p *PostAPI) updateAPIService(res *registry.Result) {
 	switch res.Action {
 	case "create", "update":
 		p.createOrUpdateMicroService(res.Service)
+		p.addServiceNodes(res.Service)
 	case "delete":
 		if len(res.Service.Nodes) == 0 {
 			p.removeMicroService(res.Service.Name)
+			delete(p.serviceNodes, res.Service.Name)
+			p.rebuildHashRing(res.Service.Name)
 		} else {
 			p.removeMicroServiceOnServiceChange(res.Service)
+			p.removeServiceNodes(res.Service)
 		}
 	}
+
+	p.snapshotChanged()
+}
+
+func (p *PostAPI) addServiceNodes(service *registry.Service) {
+	nodes, exist := p.serviceNodes[service.Name]
+	if !exist {
+		nodes = make(map[string]*registry.Node)
+		p.serviceNodes[service.Name] = nodes
+	}
+
+	for _, node := range service.Nodes {
+		nodes[node.Id] = node
+	}
+
+	p.rebuildHashRing(service.Name)
+}
+
+func (p *PostAPI) removeServiceNodes(service *registry.Service) {
+	nodes, exist := p.serviceNodes[service.Name]
+	if !exist {
+		return
+	}
+
+	for _, node := range service.Nodes {
+		delete(nodes, node.Id)
+	}
+
+	if len(nodes) == 0 {
+		delete(p.serviceNodes, service.Name)
+	}
+
+	p.rebuildHashRing(service.Name)
 }
 
 func (p *PostAPI) removeMicroService(serviceName string) {
@@ -103,11 +321,17 @@ func (p *PostAPI) createOrUpdateMicroService(service *registry.Service) (err err
 			for _, api := range apis {
 				if srvs, exist := p.apiService[api]; !exist {
 					p.apiService[api] = map[string]microService{
-						version: microService{Service: service.Name, Method: endpoint.Name},
+						version: microService{Service: service.Name, Method: endpoint.Name, Metadata: endpoint.Metadata},
 					}
 
-				} else if _, exist := srvs[version]; !exist {
-					srvs[version] = microService{Service: service.Name, Method: endpoint.Name}
+				} else if srv, exist := srvs[version]; !exist {
+					srvs[version] = microService{Service: service.Name, Method: endpoint.Name, Metadata: endpoint.Metadata}
+				} else if srv.Service == service.Name {
+					// a rolling redeploy changes the metadata (deprecation,
+					// schema, cache and hedge options) of a routed version,
+					// the route itself is kept
+					srv.Metadata = endpoint.Metadata
+					srvs[version] = srv
 				}
 			}
 		}
@@ -0,0 +1,215 @@
+package apitest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gogap-micro/post-api/api"
+	postclient "github.com/gogap-micro/post-api/client"
+	"github.com/micro/go-micro/broker"
+	mockBroker "github.com/micro/go-micro/broker/mock"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/registry"
+	"github.com/micro/go-micro/selector"
+	"github.com/micro/go-micro/server"
+	"github.com/micro/go-micro/transport"
+	mockTransport "github.com/micro/go-micro/transport/mock"
+)
+
+const (
+	firstPort = 10000
+)
+
+// Kit runs a gateway against in-memory registry, broker and transport, the
+// services of a test are registered by Handle and the gateway is called over
+// http by Client or Call
+type Kit struct {
+	Registry  registry.Registry
+	Broker    broker.Broker
+	Transport transport.Transport
+
+	PostAPI *api.PostAPI
+	Server  *httptest.Server
+
+	locker   sync.Mutex
+	messages map[string][]*broker.Message
+	servers  []server.Server
+	nextPort int
+
+	runErr chan error
+}
+
+// New starts a gateway with opts, the request and response topics are
+// enabled and recorded, the in-memory pieces and the http address could not
+// be overridden by opts
+func New(opts ...api.Option) (kit *Kit, err error) {
+	k := &Kit{
+		Registry:  NewRegistry(),
+		Broker:    mockBroker.NewBroker(),
+		Transport: mockTransport.NewTransport(),
+		messages:  make(map[string][]*broker.Message),
+		nextPort:  firstPort,
+		runErr:    make(chan error, 1),
+	}
+
+	if err = k.Broker.Connect(); err != nil {
+		return
+	}
+
+	gatewayOpts := append([]api.Option{
+		api.EnableRequestTopic(true),
+		api.EnableResponseTopic(true),
+	}, opts...)
+
+	gatewayOpts = append(gatewayOpts,
+		api.Address(""),
+		api.MicroClient(client.NewClient()),
+		api.MicroTransport(k.Transport),
+		api.MicroRegistry(k.Registry),
+		api.MicroSelector(selector.NewSelector(selector.Registry(k.Registry))),
+		api.MicroBroker(k.Broker),
+	)
+
+	if k.PostAPI, err = api.NewPostAPI(gatewayOpts...); err != nil {
+		return
+	}
+
+	for _, topic := range []string{k.PostAPI.Options.RequestTopic, k.PostAPI.Options.ResponseTopic} {
+		if err = k.record(topic); err != nil {
+			return
+		}
+	}
+
+	go func() {
+		k.runErr <- k.PostAPI.Run()
+	}()
+
+	k.Server = httptest.NewServer(k.PostAPI.Handler())
+
+	kit = k
+
+	return
+}
+
+func (p *Kit) record(topic string) (err error) {
+	_, err = p.Broker.Subscribe(topic, func(pub broker.Publication) error {
+		p.locker.Lock()
+		defer p.locker.Unlock()
+
+		p.messages[pub.Topic()] = append(p.messages[pub.Topic()], pub.Message())
+
+		return nil
+	})
+
+	return
+}
+
+// Handle starts a micro service named service serving handler, the apis of
+// handler are declared by helper.ToHandlerOption in opts. The routing table
+// of the gateway is synced before Handle returns.
+func (p *Kit) Handle(service string, handler interface{}, opts ...server.HandlerOption) (err error) {
+	p.locker.Lock()
+	address := fmt.Sprintf("127.0.0.1:%d", p.nextPort)
+	p.nextPort++
+	p.locker.Unlock()
+
+	srv := server.NewServer(
+		server.Name(service),
+		server.Address(address),
+		server.Registry(p.Registry),
+		server.Transport(p.Transport),
+		server.Broker(p.Broker),
+	)
+
+	if err = srv.Handle(srv.NewHandler(handler, opts...)); err != nil {
+		return
+	}
+
+	if err = srv.Start(); err != nil {
+		return
+	}
+
+	if err = srv.Register(); err != nil {
+		srv.Stop()
+		return
+	}
+
+	p.locker.Lock()
+	p.servers = append(p.servers, srv)
+	p.locker.Unlock()
+
+	return p.PostAPI.SyncRoutes()
+}
+
+// Client returns a client of the gateway
+func (p *Kit) Client(opts ...postclient.Option) *postclient.Client {
+	return postclient.NewClient(p.Server.URL+p.PostAPI.Options.Path, opts...)
+}
+
+// Call calls api through the gateway and decodes its result into result
+func (p *Kit) Call(api string, request, result interface{}, opts ...postclient.CallOption) error {
+	return p.Client().Call(api, request, result, opts...)
+}
+
+// Messages returns the messages published to topic so far
+func (p *Kit) Messages(topic string) []*broker.Message {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return append([]*broker.Message(nil), p.messages[topic]...)
+}
+
+// RequestMessages returns the messages of the request topic of the gateway
+func (p *Kit) RequestMessages() []*broker.Message {
+	return p.Messages(p.PostAPI.Options.RequestTopic)
+}
+
+// ResponseMessages returns the messages of the response topic of the gateway
+func (p *Kit) ResponseMessages() []*broker.Message {
+	return p.Messages(p.PostAPI.Options.ResponseTopic)
+}
+
+// WaitMessages waits until count messages are published to topic, the
+// response topic is published after the http response is written
+func (p *Kit) WaitMessages(topic string, count int, timeout time.Duration) (messages []*broker.Message, err error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if messages = p.Messages(topic); len(messages) >= count {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("%d of %d messages published to %s in %s", len(messages), count, topic, timeout)
+			return
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// Close stops the services and the gateway
+func (p *Kit) Close() (err error) {
+	p.locker.Lock()
+	servers := p.servers
+	p.servers = nil
+	p.locker.Unlock()
+
+	for _, srv := range servers {
+		srv.Deregister()
+		srv.Stop()
+	}
+
+	p.Server.Close()
+	p.PostAPI.Stop()
+
+	select {
+	case err = <-p.runErr:
+	case <-time.After(time.Second * 5):
+		err = fmt.Errorf("gateway did not stop in 5s")
+	}
+
+	return
+}
@@ -0,0 +1,68 @@
+package apitest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gogap-micro/post-api/api/helper"
+	"golang.org/x/net/context"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+type echoResponse struct {
+	Text string `json:"text"`
+}
+
+type Echo struct{}
+
+func (p *Echo) Echo(ctx context.Context, req *echoRequest, rsp *echoResponse) error {
+	rsp.Text = req.Text
+	return nil
+}
+
+func TestKitCall(t *testing.T) {
+	kit, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kit.Close()
+
+	h := &Echo{}
+	if err = kit.Handle("echo.v1", h, helper.ToHandlerOption(h.Echo, "v1", "echo.echo")); err != nil {
+		t.Fatal(err)
+	}
+
+	var rsp echoResponse
+	if err = kit.Call("echo.echo", echoRequest{Text: "hello"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Text != "hello" {
+		t.Errorf("text = %q, want hello", rsp.Text)
+	}
+
+	if n := len(kit.RequestMessages()); n != 1 {
+		t.Errorf("%d request messages, want 1", n)
+	}
+
+	messages, err := kit.WaitMessages(kit.PostAPI.Options.ResponseTopic, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event struct {
+		Responses map[string]json.RawMessage
+	}
+
+	if err = json.Unmarshal(messages[0].Body, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist := event.Responses["echo.echo"]; !exist {
+		t.Errorf("response message %s has no response of echo.echo", messages[0].Body)
+	}
+}
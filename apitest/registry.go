@@ -0,0 +1,201 @@
+package apitest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/micro/go-micro/registry"
+)
+
+var errWatcherStopped = errors.New("watcher stopped")
+
+// memoryRegistry keeps the services in memory and notifies its watchers of
+// every change
+type memoryRegistry struct {
+	locker   sync.RWMutex
+	services map[string]map[string]*registry.Service
+	watchers map[*memoryWatcher]struct{}
+}
+
+// NewRegistry returns an in-memory registry
+func NewRegistry() registry.Registry {
+	return &memoryRegistry{
+		services: make(map[string]map[string]*registry.Service),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+}
+
+func (p *memoryRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	versions, exist := p.services[s.Name]
+	if !exist {
+		versions = make(map[string]*registry.Service)
+		p.services[s.Name] = versions
+	}
+
+	srv := copyService(s)
+
+	action := "create"
+	if old, exist := versions[s.Version]; exist {
+		action = "update"
+
+		// the nodes of a version are merged like the consul registry does
+		nodes := make(map[string]*registry.Node)
+		for _, node := range old.Nodes {
+			nodes[node.Id] = node
+		}
+		for _, node := range srv.Nodes {
+			nodes[node.Id] = node
+		}
+
+		srv.Nodes = nil
+		for _, node := range nodes {
+			srv.Nodes = append(srv.Nodes, node)
+		}
+	}
+
+	versions[s.Version] = srv
+
+	p.notify(action, srv)
+
+	return nil
+}
+
+func (p *memoryRegistry) Deregister(s *registry.Service) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	versions, exist := p.services[s.Name]
+	if !exist {
+		return nil
+	}
+
+	old, exist := versions[s.Version]
+	if !exist {
+		return nil
+	}
+
+	removed := make(map[string]bool)
+	for _, node := range s.Nodes {
+		removed[node.Id] = true
+	}
+
+	srv := copyService(old)
+	srv.Nodes = nil
+	for _, node := range old.Nodes {
+		if !removed[node.Id] {
+			srv.Nodes = append(srv.Nodes, node)
+		}
+	}
+
+	if len(srv.Nodes) > 0 {
+		versions[s.Version] = srv
+		p.notify("update", srv)
+		return nil
+	}
+
+	delete(versions, s.Version)
+	if len(versions) == 0 {
+		delete(p.services, s.Name)
+	}
+
+	deleted := copyService(old)
+	deleted.Nodes = s.Nodes
+	p.notify("delete", deleted)
+
+	return nil
+}
+
+func (p *memoryRegistry) GetService(name string) ([]*registry.Service, error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	versions, exist := p.services[name]
+	if !exist {
+		return nil, registry.ErrNotFound
+	}
+
+	var services []*registry.Service
+	for _, srv := range versions {
+		services = append(services, copyService(srv))
+	}
+
+	return services, nil
+}
+
+func (p *memoryRegistry) ListServices() ([]*registry.Service, error) {
+	p.locker.RLock()
+	defer p.locker.RUnlock()
+
+	var services []*registry.Service
+	for name := range p.services {
+		services = append(services, &registry.Service{Name: name})
+	}
+
+	return services, nil
+}
+
+func (p *memoryRegistry) Watch() (registry.Watcher, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	w := &memoryWatcher{
+		registry: p,
+		results:  make(chan *registry.Result, 64),
+		stop:     make(chan struct{}),
+	}
+
+	p.watchers[w] = struct{}{}
+
+	return w, nil
+}
+
+func (p *memoryRegistry) String() string {
+	return "memory"
+}
+
+// notify should be called with locker held
+func (p *memoryRegistry) notify(action string, srv *registry.Service) {
+	for w := range p.watchers {
+		select {
+		case w.results <- &registry.Result{Action: action, Service: copyService(srv)}:
+		case <-w.stop:
+		}
+	}
+}
+
+type memoryWatcher struct {
+	registry *memoryRegistry
+	results  chan *registry.Result
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func (p *memoryWatcher) Next() (*registry.Result, error) {
+	select {
+	case result := <-p.results:
+		return result, nil
+	case <-p.stop:
+		return nil, errWatcherStopped
+	}
+}
+
+func (p *memoryWatcher) Stop() {
+	p.once.Do(func() {
+		// closing stop first releases a notify blocked on this watcher
+		close(p.stop)
+
+		p.registry.locker.Lock()
+		delete(p.registry.watchers, p)
+		p.registry.locker.Unlock()
+	})
+}
+
+func copyService(s *registry.Service) *registry.Service {
+	srv := *s
+	srv.Nodes = append([]*registry.Node(nil), s.Nodes...)
+	srv.Endpoints = append([]*registry.Endpoint(nil), s.Endpoints...)
+	return &srv
+}
@@ -0,0 +1,56 @@
+package apitest
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/registry"
+)
+
+func nextResult(t *testing.T, w registry.Watcher, action string, nodes int) {
+	result, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Action != action || len(result.Service.Nodes) != nodes {
+		t.Errorf("result = %s with %d nodes, want %s with %d nodes", result.Action, len(result.Service.Nodes), action, nodes)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	node1 := &registry.Node{Id: "echo-1", Address: "127.0.0.1", Port: 10000}
+	node2 := &registry.Node{Id: "echo-2", Address: "127.0.0.1", Port: 10001}
+
+	r.Register(&registry.Service{Name: "echo", Version: "v1", Nodes: []*registry.Node{node1}})
+	nextResult(t, w, "create", 1)
+
+	r.Register(&registry.Service{Name: "echo", Version: "v1", Nodes: []*registry.Node{node2}})
+	nextResult(t, w, "update", 2)
+
+	services, err := r.GetService("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(services) != 1 || len(services[0].Nodes) != 2 {
+		t.Errorf("services = %v, want one version with the two nodes", services)
+	}
+
+	r.Deregister(&registry.Service{Name: "echo", Version: "v1", Nodes: []*registry.Node{node1}})
+	nextResult(t, w, "update", 1)
+
+	r.Deregister(&registry.Service{Name: "echo", Version: "v1", Nodes: []*registry.Node{node2}})
+	nextResult(t, w, "delete", 1)
+
+	if _, err = r.GetService("echo"); err != registry.ErrNotFound {
+		t.Errorf("get deregistered service: err = %v, want %v", err, registry.ErrNotFound)
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// BatchCall is a call of a batch, Response and Err are set after the batch
+// is called
+type BatchCall struct {
+	API     string
+	Version string
+	Request interface{}
+
+	Response *Response
+	Err      error
+
+	result interface{}
+}
+
+// key is the name of the call in the multi-call body, api or api:version
+func (p *BatchCall) key() string {
+	if p.Version == "" {
+		return p.API
+	}
+	return p.API + ":" + p.Version
+}
+
+// Batch calls several apis in one multi-call request, an api could be added
+// once per version
+type Batch struct {
+	calls []*BatchCall
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Add adds a call of api to the batch, its result is decoded into result
+func (p *Batch) Add(api string, request, result interface{}) *BatchCall {
+	return p.AddVersion(api, "", request, result)
+}
+
+// AddVersion adds a call of a specific version of api to the batch
+func (p *Batch) AddVersion(api, version string, request, result interface{}) *BatchCall {
+	call := &BatchCall{
+		API:     api,
+		Version: version,
+		Request: request,
+		result:  result,
+	}
+
+	p.calls = append(p.calls, call)
+
+	return call
+}
+
+func (p *Batch) Calls() []*BatchCall {
+	return p.calls
+}
+
+// CallBatch calls the apis of batch in one request. The returned error is
+// set when the batch could not be called at all, the errors of the apis are
+// set to the Err of their calls.
+func (p *Client) CallBatch(batch *Batch, opts ...CallOption) (err error) {
+	callOpts := p.callOptions(opts)
+
+	body := make(map[string]interface{}, len(batch.calls))
+	for _, call := range batch.calls {
+		if _, exist := body[call.key()]; exist {
+			err = fmt.Errorf("api %s is added to the batch more than once", call.key())
+			return
+		}
+
+		request := call.Request
+		if request == nil {
+			request = struct{}{}
+		}
+
+		body[call.key()] = request
+	}
+
+	header := http.Header{}
+	header.Set(MultiCallHeader, "on")
+
+	var resp struct {
+		Response
+		Result map[string]*Response `json:"result"`
+	}
+
+	if err = p.post(callOpts, header, body, &resp); err != nil {
+		return
+	}
+
+	if e := resp.Err(); e != nil {
+		return e
+	}
+
+	for _, call := range batch.calls {
+		r, exist := resp.Result[call.key()]
+		if !exist {
+			call.Err = fmt.Errorf("no response of api %s", call.key())
+			continue
+		}
+
+		call.Response = r
+
+		if e := r.Err(); e != nil {
+			call.Err = e
+			continue
+		}
+
+		call.Err = r.Decode(call.result)
+	}
+
+	return
+}
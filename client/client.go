@@ -0,0 +1,195 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+const (
+	APIHeader            = "X-Api"
+	MultiCallHeader      = "X-Api-Multi-Call"
+	APICallTimeoutHeader = "X-Api-Call-Timeout"
+
+	// the http request waits for the gateway a little longer than the call
+	// timeout, so the gateway could answer with its timeout error
+	timeoutGrace = time.Second
+)
+
+// Violation is a field of the request not matching the schema of the api
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Response is the envelope of an api response
+type Response struct {
+	Code            uint64          `json:"code"`
+	Message         string          `json:"message,omitempty"`
+	ErrID           string          `json:"err_id,omitempty"`
+	ErrNamespace    string          `json:"err_namespace,omitempty"`
+	ResolvedVersion string          `json:"resolved_version,omitempty"`
+	Warning         string          `json:"warning,omitempty"`
+	RetryAfter      int64           `json:"retry_after,omitempty"`
+	Violations      []Violation     `json:"violations,omitempty"`
+	Result          json.RawMessage `json:"result"`
+}
+
+// Err converts the error envelope back into an errors.ErrCode with the code,
+// id and namespace of the original error, it is nil for successful responses
+func (p *Response) Err() errors.ErrCode {
+	if p.Code == 0 {
+		return nil
+	}
+
+	return errors.NewErrorCode(p.ErrID, p.Code, p.ErrNamespace, p.Message, "", nil)
+}
+
+// Decode decodes the result into v
+func (p *Response) Decode(v interface{}) error {
+	if v == nil || len(p.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(p.Result, v)
+}
+
+// Client calls the apis of a post-api gateway
+type Client struct {
+	url  string
+	opts Options
+}
+
+// NewClient returns a client of the gateway at url, like http://127.0.0.1:8088/
+func NewClient(url string, opts ...Option) *Client {
+	c := &Client{
+		url: strings.TrimSuffix(url, "/"),
+		opts: Options{
+			Version: DefaultVersion,
+			Timeout: DefaultTimeout,
+		},
+	}
+
+	for _, o := range opts {
+		o(&c.opts)
+	}
+
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = http.DefaultClient
+	}
+
+	return c
+}
+
+// Call calls api with request and decodes the result into result, the error
+// is an errors.ErrCode when the api answers with an error
+func (p *Client) Call(api string, request, result interface{}, opts ...CallOption) (err error) {
+	resp, err := p.CallResponse(api, request, opts...)
+	if err != nil {
+		return
+	}
+
+	if e := resp.Err(); e != nil {
+		return e
+	}
+
+	return resp.Decode(result)
+}
+
+// CallResponse calls api and returns the whole response envelope
+func (p *Client) CallResponse(api string, request interface{}, opts ...CallOption) (resp *Response, err error) {
+	callOpts := p.callOptions(opts)
+
+	header := http.Header{}
+	header.Set(APIHeader, api)
+
+	var r Response
+	if err = p.post(callOpts, header, request, &r); err != nil {
+		return
+	}
+
+	resp = &r
+
+	return
+}
+
+func (p *Client) callOptions(opts []CallOption) CallOptions {
+	callOpts := CallOptions{
+		Version: p.opts.Version,
+		Timeout: p.opts.Timeout,
+	}
+
+	for _, o := range opts {
+		o(&callOpts)
+	}
+
+	return callOpts
+}
+
+func (p *Client) post(opts CallOptions, header http.Header, body, v interface{}) (err error) {
+	if body == nil {
+		body = struct{}{}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("POST", p.url+"/"+opts.Version, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	for key, values := range p.opts.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	for key, values := range opts.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if opts.Timeout > 0 {
+		req.Header.Set(APICallTimeoutHeader, strconv.FormatInt(int64(opts.Timeout/time.Millisecond), 10))
+	}
+
+	httpClient := *p.opts.HTTPClient
+	if opts.Timeout > 0 {
+		httpClient.Timeout = opts.Timeout + timeoutGrace
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("post-api responded %s: %s", resp.Status, respData)
+		return
+	}
+
+	return json.Unmarshal(respData, v)
+}
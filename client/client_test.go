@@ -0,0 +1,211 @@
+package client_test
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"testing"
+
+	"github.com/gogap/errors"
+	"github.com/micro/go-micro/metadata"
+	"golang.org/x/net/context"
+
+	"github.com/gogap-micro/post-api/api"
+	"github.com/gogap-micro/post-api/api/helper"
+	"github.com/gogap-micro/post-api/apitest"
+	"github.com/gogap-micro/post-api/client"
+)
+
+const tenantHeader = "X-Tenant"
+
+type helloRequest struct {
+	Name string `json:"name"`
+}
+
+type helloResponse struct {
+	Greeting string `json:"greeting"`
+	Version  string `json:"version"`
+	Tenant   string `json:"tenant"`
+}
+
+type Greeter struct {
+	version string
+}
+
+// Hello greets req.Name, an empty name is answered by an error of the
+// GREETER namespace in the json form the gateway parses
+func (p *Greeter) Hello(ctx context.Context, req *helloRequest, rsp *helloResponse) error {
+	if req.Name == "" {
+		data, _ := json.Marshal(errors.Error{ID: "greeter-error-id", Namespace: "GREETER", Code: 404, Message: "name is empty"})
+		return stdErrors.New(string(data))
+	}
+
+	rsp.Greeting = "hello " + req.Name
+	rsp.Version = p.version
+
+	if md, ok := metadata.FromContext(ctx); ok {
+		rsp.Tenant = md[tenantHeader]
+	}
+
+	return nil
+}
+
+func newKit(t *testing.T) *apitest.Kit {
+	kit, err := apitest.New(api.MicroHeaders(tenantHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		h := &Greeter{version: version}
+		if err = kit.Handle("greeter."+version, h, helper.ToHandlerOption(h.Hello, version, "greeter.hello")); err != nil {
+			kit.Close()
+			t.Fatal(err)
+		}
+	}
+
+	return kit
+}
+
+func TestCall(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	var rsp helloResponse
+	if err := kit.Client().Call("greeter.hello", helloRequest{Name: "gopher"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Greeting != "hello gopher" {
+		t.Errorf("greeting = %q, want %q", rsp.Greeting, "hello gopher")
+	}
+
+	if rsp.Version != client.DefaultVersion {
+		t.Errorf("version = %q, want the default %q", rsp.Version, client.DefaultVersion)
+	}
+}
+
+func TestCallVersion(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	c := kit.Client(client.Version("v2"))
+
+	var rsp helloResponse
+	if err := c.Call("greeter.hello", helloRequest{Name: "gopher"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Version != "v2" {
+		t.Errorf("client version: version = %q, want v2", rsp.Version)
+	}
+
+	resp, err := c.CallResponse("greeter.hello", helloRequest{Name: "gopher"}, client.CallVersion("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.ResolvedVersion != "v1" {
+		t.Errorf("call version: resolved version = %q, want v1", resp.ResolvedVersion)
+	}
+
+	if err = resp.Decode(&rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Version != "v1" {
+		t.Errorf("call version: version = %q, want v1", rsp.Version)
+	}
+}
+
+func TestCallHeader(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	c := kit.Client(client.Header(tenantHeader, "client-tenant"))
+
+	var rsp helloResponse
+	if err := c.Call("greeter.hello", helloRequest{Name: "gopher"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Tenant != "client-tenant" {
+		t.Errorf("client header: tenant = %q, want client-tenant", rsp.Tenant)
+	}
+
+	if err := c.Call("greeter.hello", helloRequest{Name: "gopher"}, &rsp, client.CallHeader(tenantHeader, "call-tenant")); err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Tenant != "call-tenant" {
+		t.Errorf("call header: tenant = %q, want call-tenant", rsp.Tenant)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	err := kit.Client().Call("greeter.hello", helloRequest{}, nil)
+
+	errCode, ok := err.(errors.ErrCode)
+	if !ok {
+		t.Fatalf("error = %v, want an errors.ErrCode", err)
+	}
+
+	if errCode.Code() != 404 || errCode.Namespace() != "GREETER" || errCode.Id() != "greeter-error-id" {
+		t.Errorf("error = %s:%d %s, want GREETER:404 greeter-error-id", errCode.Namespace(), errCode.Code(), errCode.Id())
+	}
+}
+
+func TestCallGatewayError(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	err := kit.Client().Call("greeter.unknown", helloRequest{Name: "gopher"}, nil)
+
+	errCode, ok := err.(errors.ErrCode)
+	if !ok {
+		t.Fatalf("error = %v, want an errors.ErrCode", err)
+	}
+
+	if errCode.Code() != 400 || errCode.Namespace() != api.ErrNamespace {
+		t.Errorf("error = %s:%d, want %s:400", errCode.Namespace(), errCode.Code(), api.ErrNamespace)
+	}
+}
+
+func TestCallBatch(t *testing.T) {
+	kit := newKit(t)
+	defer kit.Close()
+
+	duplicated := client.NewBatch()
+	duplicated.Add("greeter.hello", helloRequest{Name: "one"}, nil)
+	duplicated.Add("greeter.hello", helloRequest{Name: "two"}, nil)
+
+	if err := kit.Client().CallBatch(duplicated); err == nil {
+		t.Error("adding greeter.hello twice should fail the batch")
+	}
+
+	var v1, v2 helloResponse
+
+	batch := client.NewBatch()
+	callV1 := batch.Add("greeter.hello", helloRequest{Name: "one"}, &v1)
+	callV2 := batch.AddVersion("greeter.hello", "v2", helloRequest{Name: "two"}, &v2)
+	callErr := batch.AddVersion("greeter.hello", "v1", helloRequest{}, nil)
+
+	if err := kit.Client().CallBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if callV1.Err != nil || v1.Greeting != "hello one" || v1.Version != "v1" {
+		t.Errorf("v1 call = %+v, err %v", v1, callV1.Err)
+	}
+
+	if callV2.Err != nil || v2.Greeting != "hello two" || v2.Version != "v2" {
+		t.Errorf("v2 call = %+v, err %v", v2, callV2.Err)
+	}
+
+	errCode, ok := callErr.Err.(errors.ErrCode)
+	if !ok || errCode.Code() != 404 || errCode.Namespace() != "GREETER" {
+		t.Errorf("error call err = %v, want GREETER:404", callErr.Err)
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultVersion = "v1"
+	DefaultTimeout = time.Second * 30
+)
+
+type Option func(*Options)
+
+type Options struct {
+	// Version is the api version of the calls without their own version
+	Version string
+	// Timeout is the call timeout sent to the gateway in X-Api-Call-Timeout,
+	// the http request waits a little longer for the gateway to answer
+	Timeout time.Duration
+	Header  http.Header
+
+	HTTPClient *http.Client
+}
+
+func Version(version string) Option {
+	return func(o *Options) {
+		o.Version = version
+	}
+}
+
+func Timeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// Header adds a header sent with every call, like X-Client-Id
+func Header(key, value string) Option {
+	return func(o *Options) {
+		if o.Header == nil {
+			o.Header = make(http.Header)
+		}
+		o.Header.Add(key, value)
+	}
+}
+
+func HTTPClient(c *http.Client) Option {
+	return func(o *Options) {
+		o.HTTPClient = c
+	}
+}
+
+type CallOption func(*CallOptions)
+
+type CallOptions struct {
+	Version string
+	Timeout time.Duration
+	Header  http.Header
+}
+
+// CallVersion calls the api version instead of Options.Version
+func CallVersion(version string) CallOption {
+	return func(o *CallOptions) {
+		o.Version = version
+	}
+}
+
+// CallTimeout overrides Options.Timeout for one call
+func CallTimeout(timeout time.Duration) CallOption {
+	return func(o *CallOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// CallHeader adds a header to one call, like Idempotency-Key
+func CallHeader(key, value string) CallOption {
+	return func(o *CallOptions) {
+		if o.Header == nil {
+			o.Header = make(http.Header)
+		}
+		o.Header.Add(key, value)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gogap-micro/post-api/api"
+	postclient "github.com/gogap-micro/post-api/client"
+	"github.com/gogap-micro/post-api/tsgen"
+	"github.com/micro/go-micro/metadata"
+	"golang.org/x/net/context"
+)
+
+func serveCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, the built-in defaults are used when empty")
+	flags.Parse(args)
+
+	var postAPI *api.PostAPI
+	if postAPI, err = newPostAPI(*configFile); err != nil {
+		return
+	}
+
+	return postAPI.Run()
+}
+
+func routesCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("routes", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, the built-in defaults are used when empty")
+	asJSON := flags.Bool("json", false, "print routes as json")
+	flags.Parse(args)
+
+	var postAPI *api.PostAPI
+	if postAPI, err = newPostAPI(*configFile); err != nil {
+		return
+	}
+
+	if err = postAPI.SyncRoutes(); err != nil {
+		return
+	}
+
+	for _, e := range postAPI.ValidateRouteFileServices() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", e)
+	}
+
+	routes := postAPI.Routes()
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		return encoder.Encode(routes)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "API\tVERSION\tSERVICE\tMETHOD\tSOURCE")
+	for _, route := range routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", route.API, route.Version, route.Service, route.Method, route.Source)
+	}
+
+	return w.Flush()
+}
+
+func callCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("call", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, the built-in defaults are used when empty")
+	apiName := flags.String("api", "", "api name")
+	version := flags.String("version", "v1", "api version")
+	data := flags.String("data", "{}", "json request content, prefix with @ to read it from file")
+	timeout := flags.Duration("timeout", time.Second*30, "call timeout")
+	flags.Parse(args)
+
+	if strings.TrimSpace(*apiName) == "" {
+		err = fmt.Errorf("api name is empty")
+		return
+	}
+
+	var content map[string]interface{}
+	if content, err = readContent(*data); err != nil {
+		return
+	}
+
+	var postAPI *api.PostAPI
+	if postAPI, err = newPostAPI(*configFile); err != nil {
+		return
+	}
+
+	if err = postAPI.SyncRoutes(); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var resp api.PostAPIResponse
+	if resp, err = postAPI.Call(ctx, *apiName, *version, content); err != nil {
+		return
+	}
+
+	var output []byte
+	if output, err = json.MarshalIndent(resp, "", "    "); err != nil {
+		return
+	}
+
+	fmt.Println(string(output))
+
+	return
+}
+
+func checkCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file to validate")
+	flags.Parse(args)
+
+	if *configFile == "" {
+		err = fmt.Errorf("config file is empty")
+		return
+	}
+
+	var conf *api.Config
+	if conf, err = api.LoadConfig(*configFile); err != nil {
+		return
+	}
+
+	errs := conf.Validate()
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, e)
+	}
+
+	if len(errs) > 0 {
+		err = fmt.Errorf("%d problem(s) found", len(errs))
+		return
+	}
+
+	fmt.Printf("%s: ok\n", *configFile)
+
+	return
+}
+
+func tsgenCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("tsgen", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, the built-in defaults are used when empty")
+	snapshotFile := flags.String("snapshot", "", "read the routes from a snapshot file instead of the registry")
+	output := flags.String("out", "", "output file, stdout when empty")
+	flags.Parse(args)
+
+	var routes []api.Route
+
+	if *snapshotFile != "" {
+		var snapshot *api.Snapshot
+		if snapshot, err = api.LoadSnapshot(*snapshotFile); err != nil {
+			return
+		}
+
+		routes = snapshot.Routes
+	} else {
+		var postAPI *api.PostAPI
+		if postAPI, err = newPostAPI(*configFile); err != nil {
+			return
+		}
+
+		if err = postAPI.SyncRoutes(); err != nil {
+			return
+		}
+
+		routes = postAPI.Routes()
+	}
+
+	var code []byte
+	if code, err = tsgen.Generate(routes); err != nil {
+		return
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(code)
+		return
+	}
+
+	return ioutil.WriteFile(*output, code, 0644)
+}
+
+func replayCommand(args []string) (err error) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := flags.String("file", "", "recording file written by the gateway")
+	url := flags.String("url", "", "gateway url with its path, like http://127.0.0.1:8088/api, the calls are routed to the backends directly when empty")
+	configFile := flags.String("config", "", "config file of the direct routing, the built-in defaults are used when empty")
+	ignore := flags.String("ignore", "", "comma separated fields ignored by the diff, like result.updated_at,result.items[*].id")
+	timeout := flags.Duration("timeout", time.Second*30, "call timeout")
+	flags.Parse(args)
+
+	if *file == "" {
+		err = fmt.Errorf("recording file is empty")
+		return
+	}
+
+	var recordings []api.Recording
+	if recordings, err = api.LoadRecordings(*file); err != nil {
+		return
+	}
+
+	var call func(header map[string]string, recorded api.RecordedCall) (api.PostAPIResponse, error)
+
+	if *url != "" {
+		call = gatewayReplayer(postclient.NewClient(*url, postclient.Timeout(*timeout)))
+	} else {
+		var postAPI *api.PostAPI
+		if postAPI, err = newPostAPI(*configFile); err != nil {
+			return
+		}
+
+		if err = postAPI.SyncRoutes(); err != nil {
+			return
+		}
+
+		call = directReplayer(postAPI, *timeout)
+	}
+
+	var rules []string
+	if *ignore != "" {
+		rules = strings.Split(*ignore, ",")
+	}
+
+	total, differed, failed, skipped := 0, 0, 0, 0
+
+	for _, recording := range recordings {
+		for _, recorded := range recording.Calls {
+			name := recorded.API + ":" + recorded.Version
+
+			if recorded.IsRedacted() {
+				// the redacted values are not the values the call was made with
+				skipped++
+				fmt.Printf("%s recorded at %s: skipped, the content is redacted\n", name, recording.Time.Format(time.RFC3339))
+				continue
+			}
+
+			total++
+
+			resp, e := call(recording.Header, recorded)
+			if e != nil {
+				failed++
+				fmt.Printf("%s recorded at %s: %s\n", name, recording.Time.Format(time.RFC3339), e)
+				continue
+			}
+
+			diffs := api.DiffResponses(recorded.Response, resp, rules)
+			if len(diffs) == 0 {
+				continue
+			}
+
+			differed++
+			fmt.Printf("%s recorded at %s:\n", name, recording.Time.Format(time.RFC3339))
+			for _, diff := range diffs {
+				fmt.Printf("    %s\n", diff)
+			}
+		}
+	}
+
+	fmt.Printf("%d calls replayed, %d matched, %d differed, %d failed, %d skipped\n", total, total-differed-failed, differed, failed, skipped)
+
+	if differed > 0 || failed > 0 {
+		err = fmt.Errorf("%d of %d calls did not match", differed+failed, total)
+	}
+
+	return
+}
+
+// gatewayReplayer calls the recorded calls one by one through the gateway,
+// the redacted headers are not sent
+func gatewayReplayer(c *postclient.Client) func(map[string]string, api.RecordedCall) (api.PostAPIResponse, error) {
+	return func(header map[string]string, recorded api.RecordedCall) (resp api.PostAPIResponse, err error) {
+		opts := []postclient.CallOption{postclient.CallVersion(recorded.Version)}
+		for key, value := range header {
+			if value != api.Redacted {
+				opts = append(opts, postclient.CallHeader(key, value))
+			}
+		}
+
+		var r *postclient.Response
+		if r, err = c.CallResponse(recorded.API, recorded.Content, opts...); err != nil {
+			return
+		}
+
+		resp = api.PostAPIResponse{
+			Code:            r.Code,
+			Message:         r.Message,
+			ErrID:           r.ErrID,
+			ErrNamespace:    r.ErrNamespace,
+			ResolvedVersion: r.ResolvedVersion,
+		}
+
+		if len(r.Result) > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(r.Result))
+			decoder.UseNumber()
+			err = decoder.Decode(&resp.Result)
+		}
+
+		return
+	}
+}
+
+// directReplayer calls the backends of the recorded calls by the routing
+// table of postAPI, the recorded headers are sent as micro metadata
+func directReplayer(postAPI *api.PostAPI, timeout time.Duration) func(map[string]string, api.RecordedCall) (api.PostAPIResponse, error) {
+	return func(header map[string]string, recorded api.RecordedCall) (api.PostAPIResponse, error) {
+		md := make(metadata.Metadata)
+		for key, value := range header {
+			if value != api.Redacted {
+				md[key] = value
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(metadata.NewContext(context.Background(), md), timeout)
+		defer cancel()
+
+		return postAPI.Call(ctx, recorded.API, recorded.Version, recorded.Content)
+	}
+}
+
+func readContent(data string) (content map[string]interface{}, err error) {
+	raw := []byte(data)
+
+	if strings.HasPrefix(data, "@") {
+		if raw, err = ioutil.ReadFile(data[1:]); err != nil {
+			return
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&content); err != nil {
+		err = fmt.Errorf("parse request content failed: %s", err)
+		return
+	}
+
+	return
+}
@@ -1,12 +1,65 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"sort"
+
 	"github.com/gogap-micro/post-api/api"
 )
 
+type command struct {
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":  {Usage: "run the gateway", Run: serveCommand},
+	"routes": {Usage: "print the api table built from the registry", Run: routesCommand},
+	"call":   {Usage: "invoke an api through the gateway routing", Run: callCommand},
+	"check":  {Usage: "validate a config file", Run: checkCommand},
+	"tsgen":  {Usage: "generate a TypeScript client of the apis", Run: tsgenCommand},
+	"replay": {Usage: "replay recorded calls and diff the responses", Run: replayCommand},
+}
+
 func main() {
+	name := "serve"
+	args := os.Args[1:]
+
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, exist := commands[name]
+	if !exist {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.Run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "post-api %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
 
-	postAPI, _ := api.NewPostAPI(
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: post-api <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].Usage)
+	}
+}
+
+func defaultOptions() []api.Option {
+	return []api.Option{
 		api.Address(":8088"),
 		api.CORS(api.CORSOptions{
 			AllowOrigins:     []string{"*"},
@@ -14,10 +67,26 @@ func main() {
 			AllowCredentials: true,
 		}),
 		api.ResponseHeader("Server", "post-api"),
-		api.Path("/api"),
+		api.Path(api.DefaultPath),
 		api.EnableResponseTopic(true),
 		api.EnableRequestTopic(true),
-	)
+	}
+}
+
+func newPostAPI(configFile string) (postAPI *api.PostAPI, err error) {
+	if configFile == "" {
+		return api.NewPostAPI(defaultOptions()...)
+	}
+
+	var conf *api.Config
+	if conf, err = api.LoadConfig(configFile); err != nil {
+		return
+	}
+
+	if errs := conf.Validate(); len(errs) > 0 {
+		err = fmt.Errorf("invalid config %s: %s", configFile, errs[0])
+		return
+	}
 
-	postAPI.Run()
+	return api.NewPostAPI(conf.Options()...)
 }
@@ -0,0 +1,378 @@
+package tsgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/gogap-micro/post-api/api"
+	"github.com/gogap-micro/post-api/api/helper"
+)
+
+// Generate generates a TypeScript client with one function per api and
+// version of routes, the request and response types come from the schemas in
+// the endpoint metadata and are any when the api publishes no schema
+func Generate(routes []api.Route) (code []byte, err error) {
+	sorted := make([]api.Route, len(routes))
+	copy(sorted, routes)
+
+	sort.Sort(routesSorter(sorted))
+
+	var funcs []tsFunc
+	names := make(map[string]string)
+
+	for _, route := range sorted {
+		name := funcName(route.API, route.Version)
+		if other, exist := names[name]; exist {
+			err = fmt.Errorf("api %s:%s and %s have the same function name %s", route.API, route.Version, other, name)
+			return
+		}
+		names[name] = route.API + ":" + route.Version
+
+		typeName := strings.ToUpper(name[:1]) + name[1:]
+
+		var reqType, rspType string
+		if reqType, err = schemaType(route.Metadata[helper.APISchemaMetadataKey], ""); err != nil {
+			err = fmt.Errorf("request schema of %s:%s: %s", route.API, route.Version, err)
+			return
+		}
+
+		if rspType, err = schemaType(route.Metadata[helper.APIResponseSchemaMetadataKey], ""); err != nil {
+			err = fmt.Errorf("response schema of %s:%s: %s", route.API, route.Version, err)
+			return
+		}
+
+		funcs = append(funcs, tsFunc{
+			Name:        name,
+			API:         route.API,
+			Version:     route.Version,
+			Request:     typeName + "Request",
+			Response:    typeName + "Response",
+			RequestDef:  reqType,
+			ResponseDef: rspType,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err = clientTemplate.Execute(&buf, funcs); err != nil {
+		return
+	}
+
+	code = buf.Bytes()
+
+	return
+}
+
+type tsFunc struct {
+	Name        string
+	API         string
+	Version     string
+	Request     string
+	Response    string
+	RequestDef  string
+	ResponseDef string
+}
+
+// funcName converts user.get and v1 to userGetV1
+func funcName(api, version string) string {
+	var buf bytes.Buffer
+
+	upper := false
+	for _, r := range api + "_" + version {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = buf.Len() > 0
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		} else if buf.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+
+		buf.WriteRune(r)
+	}
+
+	name := buf.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "api" + name
+	}
+
+	return name
+}
+
+func schemaType(data, indent string) (string, error) {
+	if data == "" {
+		return "any", nil
+	}
+
+	schema, err := helper.ParseSchema(data)
+	if err != nil {
+		return "", err
+	}
+
+	return tsType(schema, indent), nil
+}
+
+// tsType converts a json schema to a TypeScript type
+func tsType(schema *helper.JSONSchema, indent string) string {
+	if schema == nil {
+		return "any"
+	}
+
+	if len(schema.Enum) > 0 {
+		literals := make([]string, 0, len(schema.Enum))
+		for _, e := range schema.Enum {
+			data, _ := json.Marshal(e)
+			literals = append(literals, string(data))
+		}
+		return strings.Join(literals, " | ")
+	}
+
+	if len(schema.Type) == 0 {
+		return "any"
+	}
+
+	types := make([]string, 0, len(schema.Type))
+	for _, t := range schema.Type {
+		types = append(types, tsSingleType(t, schema, indent))
+	}
+
+	return strings.Join(types, " | ")
+}
+
+func tsSingleType(t string, schema *helper.JSONSchema, indent string) string {
+	switch t {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "null":
+		return "null"
+	case "array":
+		item := tsType(schema.Items, indent)
+		if strings.ContainsAny(item, " |{") {
+			return "Array<" + item + ">"
+		}
+		return item + "[]"
+	case "object":
+		return tsObject(schema, indent)
+	}
+
+	return "any"
+}
+
+func tsObject(schema *helper.JSONSchema, indent string) string {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		optional := "?"
+		if required[name] {
+			optional = ""
+		}
+
+		lines = append(lines, fmt.Sprintf("%s  %s%s: %s;", indent, propertyName(name), optional, tsType(schema.Properties[name], indent+"  ")))
+	}
+
+	if ap := schema.AdditionalProperties; ap == nil || ap.Allowed {
+		value := "any"
+		if ap != nil && ap.Schema != nil {
+			value = tsType(ap.Schema, indent+"  ")
+		}
+
+		if len(names) == 0 || value != "any" {
+			lines = append(lines, fmt.Sprintf("%s  [key: string]: %s;", indent, value))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "{}"
+	}
+
+	return "{\n" + strings.Join(lines, "\n") + "\n" + indent + "}"
+}
+
+func propertyName(name string) string {
+	for i, r := range name {
+		if !(unicode.IsLetter(r) || r == '_' || r == '$' || (i > 0 && unicode.IsDigit(r))) {
+			data, _ := json.Marshal(name)
+			return string(data)
+		}
+	}
+	return name
+}
+
+type routesSorter []api.Route
+
+func (p routesSorter) Len() int      { return len(p) }
+func (p routesSorter) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p routesSorter) Less(i, j int) bool {
+	if p[i].API != p[j].API {
+		return p[i].API < p[j].API
+	}
+	return p[i].Version < p[j].Version
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by post-api tsgen. DO NOT EDIT.
+
+export interface Violation {
+  field: string;
+  message: string;
+}
+
+export interface PostAPIResponse<T> {
+  code: number;
+  message?: string;
+  err_id?: string;
+  err_namespace?: string;
+  resolved_version?: string;
+  warning?: string;
+  target?: string;
+  cache?: string;
+  etag?: string;
+  replayed?: boolean;
+  retry_after?: number;
+  violations?: Violation[];
+  result: T;
+}
+
+export class PostAPIError extends Error {
+  code: number;
+  errId: string;
+  errNamespace: string;
+  violations: Violation[];
+
+  constructor(resp: PostAPIResponse<unknown>) {
+    super(resp.message || "post-api error " + resp.code);
+    this.name = "PostAPIError";
+    this.code = resp.code;
+    this.errId = resp.err_id || "";
+    this.errNamespace = resp.err_namespace || "";
+    this.violations = resp.violations || [];
+  }
+}
+
+export interface ClientOptions {
+  // baseURL is the gateway url with its path, like https://example.com/api
+  baseURL: string;
+  // version is the version of the batch calls, v1 by default
+  version?: string;
+  // timeout is the call timeout in milliseconds
+  timeout?: number;
+  headers?: { [name: string]: string };
+  fetch?: typeof fetch;
+}
+
+export interface CallOptions {
+  timeout?: number;
+  headers?: { [name: string]: string };
+}
+
+// BatchCall is a call of a batch, key is api:version of the multi-call body
+export interface BatchCall<T> {
+  key: string;
+  request: unknown;
+  __result?: T;
+}
+
+export type BatchResults<T> = {
+  [K in keyof T]: T[K] extends BatchCall<infer R> ? PostAPIResponse<R> : never;
+};
+{{range .}}
+export type {{.Request}} = {{.RequestDef}};
+
+export type {{.Response}} = {{.ResponseDef}};
+{{end}}
+// calls creates the batch calls of the apis
+export const calls = {
+{{- range .}}
+  {{.Name}}: (request: {{.Request}}): BatchCall<{{.Response}}> => ({ key: "{{.API}}:{{.Version}}", request }),
+{{- end}}
+};
+
+export class PostAPIClient {
+  private options: ClientOptions;
+
+  constructor(options: ClientOptions) {
+    this.options = options;
+  }
+
+  async call<T>(api: string, version: string, request: unknown, options: CallOptions = {}): Promise<T> {
+    const resp = await this.post<PostAPIResponse<T>>(version, { "X-Api": api }, request, options);
+    if (resp.code !== 0) {
+      throw new PostAPIError(resp);
+    }
+    return resp.result;
+  }
+
+  // batch calls several apis in one multi-call request, the result of each
+  // call is returned under its name, api errors are not thrown
+  async batch<T extends { [name: string]: BatchCall<any> }>(batchCalls: T, options: CallOptions = {}): Promise<BatchResults<T>> {
+    const body: { [key: string]: unknown } = {};
+    for (const name of Object.keys(batchCalls)) {
+      const key = batchCalls[name].key;
+      if (key in body) {
+        throw new Error("api " + key + " is added to the batch more than once");
+      }
+      body[key] = batchCalls[name].request;
+    }
+
+    const resp = await this.post<PostAPIResponse<{ [key: string]: PostAPIResponse<any> }>>(
+      this.options.version || "v1", { "X-Api-Multi-Call": "on" }, body, options);
+    if (resp.code !== 0) {
+      throw new PostAPIError(resp);
+    }
+
+    const results: { [name: string]: PostAPIResponse<any> } = {};
+    for (const name of Object.keys(batchCalls)) {
+      results[name] = resp.result[batchCalls[name].key];
+    }
+    return results as unknown as BatchResults<T>;
+  }
+{{range .}}
+  {{.Name}}(request: {{.Request}}, options?: CallOptions): Promise<{{.Response}}> {
+    return this.call<{{.Response}}>("{{.API}}", "{{.Version}}", request, options);
+  }
+{{end}}
+  private async post<T>(version: string, headers: { [name: string]: string }, body: unknown, options: CallOptions): Promise<T> {
+    const timeout = options.timeout || this.options.timeout;
+    const allHeaders: { [name: string]: string } = {
+      "Content-Type": "application/json",
+      ...this.options.headers,
+      ...options.headers,
+      ...headers,
+    };
+    if (timeout) {
+      allHeaders["X-Api-Call-Timeout"] = String(timeout);
+    }
+
+    const doFetch = this.options.fetch || fetch;
+    const resp = await doFetch(this.options.baseURL.replace(/\/$/, "") + "/" + version, {
+      method: "POST",
+      headers: allHeaders,
+      body: JSON.stringify(body || {}),
+    });
+    if (!resp.ok) {
+      throw new Error("post-api responded " + resp.status);
+    }
+    return (await resp.json()) as T;
+  }
+}
+`))